@@ -1,395 +1,996 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"slices"
+	"strings"
 )
 
 type Stmt interface {
-	evaluate(env *Env) RuntimeVal
+	evaluate(env *Env) (RuntimeVal, error)
+	getSpan() lexer.Span
 }
 type Expr interface {
-	evaluate(env *Env) RuntimeVal
+	evaluate(env *Env) (RuntimeVal, error)
+	getSpan() lexer.Span
+}
+
+// Node is embedded in every statement and expression to record where it was
+// written in the source.
+type Node struct {
+	span lexer.Span
 }
 
 type Program struct {
+	Node
 	body []Stmt
 }
 type VarDeclaration struct {
+	Node
 	constant   bool
 	identifier string
 	value      Expr
 }
 type FunctionDeclaration struct {
-	parameters []string
+	Node
+	parameters []Parameter
+	name       string
+	body       []Stmt
+}
+type FunctionExpr struct {
+	Node
+	parameters []Parameter
 	name       string
 	body       []Stmt
+	arrow      bool
+}
+
+// Parameter is a function parameter: `name`, `name = default` or `...name`.
+type Parameter struct {
+	Node
+	name string
+	// defaultValue is evaluated when the argument is left out, nil for required parameters.
+	defaultValue Expr
+	// rest gathers the remaining arguments into an array.
+	rest bool
 }
 type IfStmt struct {
+	Node
 	condition   Expr
 	body        []Stmt
 	alternative []Stmt
 }
+type MatchStmt struct {
+	Node
+	value Expr
+	arms  []MatchArm
+	// fallback is the body of the `else` arm, nil when there is none.
+	fallback []Stmt
+}
+type MatchArm struct {
+	Node
+	values []Expr
+	body   []Stmt
+}
 type WhileStmt struct {
+	Node
 	condition Expr
 	body      []Stmt
 }
+type ForStmt struct {
+	Node
+	// init, condition and update are nil when left out, as in `for (;;)`.
+	init      Stmt
+	condition Expr
+	update    Expr
+	body      []Stmt
+}
+type ForInStmt struct {
+	Node
+	variable string
+	constant bool
+	// declaredAt is the span of the loop variable.
+	declaredAt lexer.Span
+	iterable   Expr
+	body       []Stmt
+}
+type ReturnStmt struct {
+	Node
+	value Expr
+}
+type ThrowStmt struct {
+	Node
+	value Expr
+}
+type TryStmt struct {
+	Node
+	body []Stmt
+	// catchParam is empty for `catch { }`, and catchBody is nil without a catch clause.
+	catchParam     string
+	catchParamSpan lexer.Span
+	catchBody      []Stmt
+	// finally is nil without a finally clause.
+	finally []Stmt
+}
+type BreakStmt struct {
+	Node
+}
+type ContinueStmt struct {
+	Node
+}
 type AssigmentExpr struct {
+	Node
 	assigne Expr
 	value   Expr
+	// operator is "=" or a compound operator such as "+=".
+	operator string
+}
+
+// UpdateExpr is `++x`, `x++`, `--x` or `x--`.
+type UpdateExpr struct {
+	Node
+	target   Expr
+	operator string
+	prefix   bool
 }
 type Property struct {
+	Node
 	key   string
 	value Expr
 }
 type ObjectLiteral struct {
+	Node
 	properties []Property
 }
 type BooleanExpr struct {
+	Node
+	left     Expr
+	right    Expr
+	operator string
+}
+
+// ConditionalExpr is `condition ? consequent : alternative`.
+type ConditionalExpr struct {
+	Node
+	condition   Expr
+	consequent  Expr
+	alternative Expr
+}
+type LogicalExpr struct {
+	Node
 	left     Expr
 	right    Expr
 	operator string
 }
 type CallExpr struct {
+	Node
 	args   []Expr
 	caller Expr
 }
 type MemberExpr struct {
+	Node
 	object   Expr
 	property Expr
 	computed bool
 }
+
+// SpreadExpr is `...array` in a call's arguments or an array literal.
+type SpreadExpr struct {
+	Node
+	argument Expr
+}
 type BinaryExpr struct {
+	Node
 	left     Expr
 	right    Expr
 	operator string
 }
 type UnaryExpression struct {
+	Node
 	operator string
 	operand  Expr
 }
 type Identifier struct {
+	Node
 	symbol string
 }
 type NumericLiteral struct {
-	value int64
+	Node
+	value      int64
+	floatValue float64
+	isFloat    bool
 }
 type StringLiteral struct {
+	Node
 	value string
 }
 type ArrayLiteral struct {
+	Node
 	elements []Expr
 }
+type TemplateLiteral struct {
+	Node
+	parts []Expr
+}
 
-func (p Program) evaluate(env *Env) RuntimeVal {
-	var lastEvaluated RuntimeVal = NullVal{}
-	for _, stmt := range p.body {
-		lastEvaluated = stmt.evaluate(env)
-	}
-	return lastEvaluated
+func (n Node) getSpan() lexer.Span {
+	return n.span
+}
+
+// Control flow signals travel through the error return of evaluate, so every
+// enclosing block stops and hands them up to the loop or call that handles them.
+type returnSignal struct {
+	value RuntimeVal
+}
+type breakSignal struct{}
+type continueSignal struct{}
+
+func (returnSignal) Error() string {
+	return "return outside of a function"
+}
+func (breakSignal) Error() string {
+	return "break outside of a loop"
+}
+func (continueSignal) Error() string {
+	return "continue outside of a loop"
+}
+
+func (p Program) evaluate(env *Env) (RuntimeVal, error) {
+	return evaluateBody(p.body, env)
 }
-func (v VarDeclaration) evaluate(env *Env) RuntimeVal {
+func (v VarDeclaration) evaluate(env *Env) (RuntimeVal, error) {
 	var value RuntimeVal = NullVal{}
 	if v.value != nil {
-		value = v.value.evaluate(env)
+		val, err := v.value.evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		value = val
 	}
-	val, err := env.declareVar(v.identifier, value, v.constant)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	val, err := env.declareVarAt(v.identifier, value, v.constant, v.span)
+	return val, withSpan(err, v.span)
+}
+func (f FunctionDeclaration) evaluate(env *Env) (RuntimeVal, error) {
+	fn := newFunction(f.name, f.parameters, env, f.body, f.span)
+	val, err := env.declareVarAt(f.name, fn, true, f.span)
+	return val, withSpan(err, f.span)
+}
+func (f FunctionExpr) evaluate(env *Env) (RuntimeVal, error) {
+	name := f.name
+	if name == "" {
+		name = "<anonymous>"
 	}
-	return val
+	fn := newFunction(name, f.parameters, env, f.body, f.span)
+	fn.arrow = f.arrow
+	return fn, nil
 }
-func (f FunctionDeclaration) evaluate(env *Env) RuntimeVal {
-	fn := Function{
-		name:           f.name,
-		parameters:     f.parameters,
-		declarationEnv: env,
-		body:           f.body,
+func (i IfStmt) evaluate(env *Env) (RuntimeVal, error) {
+	condition, err := evaluateCondition(i.condition, env, "If")
+	if err != nil {
+		return nil, err
+	}
+
+	scope := newScope(env)
+	if condition {
+		_, err = evaluateBody(i.body, &scope)
+	} else {
+		_, err = evaluateBody(i.alternative, &scope)
 	}
-	val, err := env.declareVar(f.name, fn, true)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return val
+
+	return NullVal{}, nil
 }
-func (i IfStmt) evaluate(env *Env) RuntimeVal {
-	condition, ok := i.condition.evaluate(env).(BooleanVal)
-	if !ok {
-		fmt.Println("If condition must be a boolean.")
+func (m MatchStmt) evaluate(env *Env) (RuntimeVal, error) {
+	value, err := m.value.evaluate(env)
+	if err != nil {
+		return nil, err
 	}
 
-	if condition.value {
-		scope := newScope(env)
-		for _, stmt := range i.body {
-			stmt.evaluate(&scope)
+	body := m.fallback
+arms:
+	for _, arm := range m.arms {
+		for _, armValue := range arm.values {
+			val, err := armValue.evaluate(env)
+			if err != nil {
+				return nil, err
+			}
+			// Unlike `==`, an arm of another type simply does not match.
+			if valuesEqual(value, val) {
+				body = arm.body
+				break arms
+			}
 		}
-	} else {
-		scope := newScope(env)
-		for _, stmt := range i.alternative {
-			stmt.evaluate(&scope)
+	}
+
+	if body == nil {
+		return NullVal{}, nil
+	}
+	scope := newScope(env)
+	return evaluateBody(body, &scope)
+}
+func (w WhileStmt) evaluate(env *Env) (RuntimeVal, error) {
+	for {
+		condition, err := evaluateCondition(w.condition, env, "While")
+		if err != nil || !condition {
+			return NullVal{}, err
+		}
+
+		if done, err := evaluateLoopBody(w.body, env); done {
+			return NullVal{}, err
+		}
+	}
+}
+func (f ForStmt) evaluate(env *Env) (RuntimeVal, error) {
+	loopScope := newScope(env)
+	scope := &loopScope
+	if f.init != nil {
+		if _, err := f.init.evaluate(scope); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if f.condition != nil {
+			condition, err := evaluateCondition(f.condition, scope, "For")
+			if err != nil || !condition {
+				return NullVal{}, err
+			}
+		}
+
+		if done, err := evaluateLoopBody(f.body, scope); done {
+			return NullVal{}, err
+		}
+
+		// Every iteration gets its own copy of the loop variables, so closures
+		// created in the body keep the values of their iteration.
+		next := scope.copyScope()
+		scope = &next
+		if f.update != nil {
+			if _, err := f.update.evaluate(scope); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+func (f ForInStmt) evaluate(env *Env) (RuntimeVal, error) {
+	val, err := f.iterable.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []RuntimeVal
+	switch val := val.(type) {
+	case Array:
+		items = slices.Clone(val.elements)
+	case Object:
+		for _, key := range val.keys() {
+			items = append(items, StringVaL{value: key})
+		}
+	case StringVaL:
+		for _, char := range val.value {
+			items = append(items, StringVaL{value: string(char)})
 		}
+	default:
+		return nil, newTypeError(f.iterable.getSpan(), "Cannot iterate over %s, expected an array, object or string", val.getType())
 	}
 
-	return NullVal{}
+	for _, item := range items {
+		scope := newScope(env)
+		scope.declareVarAt(f.variable, item, f.constant, f.declaredAt)
+		if done, err := evaluateLoopBody(f.body, &scope); done {
+			return NullVal{}, err
+		}
+	}
+	return NullVal{}, nil
 }
-func (w WhileStmt) evaluate(env *Env) RuntimeVal {
-	condition, ok := w.condition.evaluate(env).(BooleanVal)
+
+// evaluateCondition evaluates the condition of an if statement or loop.
+func evaluateCondition(condition Expr, env *Env, statement string) (bool, error) {
+	val, err := condition.evaluate(env)
+	if err != nil {
+		return false, err
+	}
+	value, ok := env.toCondition(val)
 	if !ok {
-		fmt.Println("While condition must be a boolean.")
+		return false, newTypeError(condition.getSpan(), "%s condition must be a boolean, got %s", statement, val.getType())
 	}
+	return value, nil
+}
 
-	for condition.value {
-		scope := newScope(env)
-		for _, stmt := range w.body {
-			stmt.evaluate(&scope)
+// evaluateLoopBody runs one iteration of a loop body in its own scope. It
+// reports whether the loop is done, because of break or an error.
+func evaluateLoopBody(body []Stmt, env *Env) (bool, error) {
+	scope := newScope(env)
+	_, err := evaluateBody(body, &scope)
+	switch err.(type) {
+	case nil, continueSignal:
+		return false, nil
+	case breakSignal:
+		return true, nil
+	default:
+		return true, err
+	}
+}
+func (r ReturnStmt) evaluate(env *Env) (RuntimeVal, error) {
+	var value RuntimeVal = NullVal{}
+	if r.value != nil {
+		val, err := r.value.evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		value = val
+	}
+	return nil, returnSignal{value}
+}
+func (t ThrowStmt) evaluate(env *Env) (RuntimeVal, error) {
+	value, err := t.value.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	return nil, thrownError(value, t.span)
+}
+func (t TryStmt) evaluate(env *Env) (RuntimeVal, error) {
+	scope := newScope(env)
+	_, err := evaluateBody(t.body, &scope)
+
+	// Control flow signals such as return pass through; only errors are caught.
+	var interpreterErr *InterpreterError
+	if t.catchBody != nil && errors.As(err, &interpreterErr) {
+		withStack(err, env.callStack)
+		catchScope := newScope(env)
+		if t.catchParam != "" {
+			catchScope.declareVarAt(t.catchParam, interpreterErr.toValue(), false, t.catchParamSpan)
 		}
+		_, err = evaluateBody(t.catchBody, &catchScope)
+	}
 
-		condition = w.condition.evaluate(env).(BooleanVal)
+	// An error or signal from finally replaces the one from the try or catch block.
+	if t.finally != nil {
+		finallyScope := newScope(env)
+		if _, finallyErr := evaluateBody(t.finally, &finallyScope); finallyErr != nil {
+			return nil, finallyErr
+		}
 	}
-	return NullVal{}
+	if err != nil {
+		return nil, err
+	}
+	return NullVal{}, nil
 }
-func (a AssigmentExpr) evaluate(env *Env) RuntimeVal {
-	ident, ok := a.assigne.(Identifier)
-	if !ok {
-		println("Invalid LHS inside assigment expression", a.assigne)
-		os.Exit(1)
+func (BreakStmt) evaluate(_ *Env) (RuntimeVal, error) {
+	return nil, breakSignal{}
+}
+func (ContinueStmt) evaluate(_ *Env) (RuntimeVal, error) {
+	return nil, continueSignal{}
+}
+func (a AssigmentExpr) evaluate(env *Env) (RuntimeVal, error) {
+	_, value, err := assignTo(env, a.assigne, a.operator != "=", func(current RuntimeVal) (RuntimeVal, error) {
+		value, err := a.value.evaluate(env)
+		if err != nil || a.operator == "=" {
+			return value, err
+		}
+		return evaluateBinary(current, value, strings.TrimSuffix(a.operator, "="), a.span)
+	})
+	return value, withSpan(err, a.span)
+}
+func (u UpdateExpr) evaluate(env *Env) (RuntimeVal, error) {
+	operator := u.operator[:1]
+	old, value, err := assignTo(env, u.target, true, func(current RuntimeVal) (RuntimeVal, error) {
+		if _, ok := current.(NumberVal); !ok {
+			return nil, newTypeError(u.span, "invalid operation: operator %s not defined on type %s", u.operator, current.getType())
+		}
+		return evaluateBinary(current, NumberVal{value: 1}, operator, u.span)
+	})
+	if err != nil {
+		return nil, withSpan(err, u.span)
+	}
+	if u.prefix {
+		return value, nil
 	}
+	return old, nil
+}
 
-	return env.assignVar(ident.symbol, a.value.evaluate(env))
+// assignTo stores the value returned by compute in target, a variable or a
+// member expression. When readCurrent is set, compute receives the target's
+// value before the assignment, otherwise it receives nil. The target is only
+// evaluated once, so `arr[next()] += 1` calls next a single time.
+func assignTo(env *Env, target Expr, readCurrent bool, compute func(current RuntimeVal) (RuntimeVal, error)) (old RuntimeVal, value RuntimeVal, err error) {
+	switch target := target.(type) {
+	case Identifier:
+		if readCurrent {
+			if old, err = target.evaluate(env); err != nil {
+				return nil, nil, err
+			}
+		}
+		if value, err = compute(old); err != nil {
+			return nil, nil, err
+		}
+		value, err = env.assignVar(target.symbol, value)
+		return old, value, err
+	case MemberExpr:
+		slot, err := target.resolveSlot(env)
+		if err != nil {
+			return nil, nil, err
+		}
+		if readCurrent {
+			if old, err = target.get(slot); err != nil {
+				return nil, nil, err
+			}
+		}
+		if value, err = compute(old); err != nil {
+			return nil, nil, err
+		}
+		if err := target.set(slot, value); err != nil {
+			return nil, nil, err
+		}
+		return old, value, nil
+	default:
+		return nil, nil, newSyntaxError(target.getSpan(), "Invalid LHS inside assigment expression %v", target)
+	}
 }
-func (o ObjectLiteral) evaluate(env *Env) RuntimeVal {
+func (o ObjectLiteral) evaluate(env *Env) (RuntimeVal, error) {
 	properties := make(map[string]RuntimeVal)
 
 	for _, p := range o.properties {
 		var value RuntimeVal
+		var err error
 
 		if p.value == nil {
-			value = env.lookupVar(p.key)
+			value, err = env.lookupVar(p.key)
+			err = withSpan(err, p.span)
 		} else {
-			value = p.value.evaluate(env)
+			value, err = p.value.evaluate(env)
+		}
+		if err != nil {
+			return nil, err
 		}
 
 		properties[p.key] = value
 	}
 
-	return Object{properties: properties}
+	return Object{properties: properties}, nil
 }
 
-func (c CallExpr) evaluate(env *Env) RuntimeVal {
-
-	args := make([]RuntimeVal, len(c.args))
-
-	for i, a := range c.args {
-		args[i] = a.evaluate(env)
+func (c CallExpr) evaluate(env *Env) (RuntimeVal, error) {
+	args, err := evaluateList(c.args, env)
+	if err != nil {
+		return nil, err
+	}
+	this, function, err := c.evaluateCaller(env)
+	if err != nil {
+		return nil, err
 	}
-	function := c.caller.evaluate(env)
 	nativeFn, ok := function.(NativeFn)
 	if ok {
-		return nativeFn.call(args, env)
+		val, err := nativeFn.call(args, env)
+		return val, withSpan(err, c.span)
 	}
 	fn, ok := function.(Function)
 	if ok {
-		scope := newScope(fn.declarationEnv)
+		return fn.call(this, args, c.span, env)
+	}
 
-		if len(args) < len(fn.parameters) {
-			fmt.Printf("Function %v expects %v arguments and got only %v\n", fn.name, len(args), len(fn.parameters))
-		}
-		for i, param := range fn.parameters {
-			scope.declareVar(param, args[i], false)
+	return nil, newTypeError(c.caller.getSpan(), "Cannot call value that is not a function: %s", function.getType())
+}
+
+// evaluateCaller returns the function to call and the value `this` is bound
+// to: the object or array for method calls like `obj.method()`, null otherwise.
+func (c CallExpr) evaluateCaller(env *Env) (RuntimeVal, RuntimeVal, error) {
+	member, ok := c.caller.(MemberExpr)
+	if !ok {
+		function, err := c.caller.evaluate(env)
+		return NullVal{}, function, err
+	}
+
+	slot, err := member.resolveSlot(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	function, err := member.get(slot)
+	return slot.object, function, err
+}
+
+// call runs a script function with args, called from callSite.
+func (fn Function) call(this RuntimeVal, args []RuntimeVal, callSite lexer.Span, env *Env) (RuntimeVal, error) {
+	if len(env.callStack.frames) >= env.options.maxCallDepth {
+		err := newRangeError(callSite, "Maximum call depth of %d exceeded", env.options.maxCallDepth)
+		return nil, withStack(err, env.callStack)
+	}
+	if err := fn.checkArity(len(args), callSite); err != nil {
+		return nil, err
+	}
+
+	env.callStack.push(fn.name, callSite)
+	defer env.callStack.pop()
+
+	scope := newScope(fn.declarationEnv)
+	if !fn.arrow {
+		scope.declareVar("this", this, true)
+	}
+	for i, param := range fn.parameters {
+		var value RuntimeVal
+		switch {
+		case param.rest:
+			value = Array{slices.Clone(args[min(i, len(args)):])}
+		case i < len(args):
+			value = args[i]
+		default:
+			// Defaults are evaluated in the function's scope, so they can use
+			// the parameters before them.
+			val, err := param.defaultValue.evaluate(&scope)
+			if err != nil {
+				return nil, withStack(err, env.callStack)
+			}
+			value = val
 		}
+		scope.declareVarAt(param.name, value, false, param.span)
+	}
 
-		var result RuntimeVal = NullVal{}
+	result, err := evaluateBody(fn.body, &scope)
+	if signal, ok := err.(returnSignal); ok {
+		return signal.value, nil
+	}
+	return result, withStack(err, env.callStack)
+}
 
-		for _, stmt := range fn.body {
-			result = stmt.evaluate(&scope)
+// checkArity reports a TypeError when a call passes fewer arguments than the
+// function's required parameters, or more than it has parameters without a
+// rest parameter.
+func (fn Function) checkArity(count int, callSite lexer.Span) error {
+	required, allowed, variadic := 0, 0, false
+	for i, param := range fn.parameters {
+		switch {
+		case param.rest:
+			variadic = true
+		case param.defaultValue == nil:
+			required = i + 1
+			allowed++
+		default:
+			allowed++
 		}
-		return result
+	}
+	if count >= required && (variadic || count <= allowed) {
+		return nil
 	}
 
-	println("Cannot call value that is not a function.")
-	os.Exit(1)
-	panic("Unreachable code")
+	var expected string
+	switch {
+	case variadic:
+		expected = fmt.Sprintf("at least %d", required)
+	case required == allowed:
+		expected = fmt.Sprint(required)
+	default:
+		expected = fmt.Sprintf("%d to %d", required, allowed)
+	}
+	noun := "arguments"
+	if strings.HasSuffix(expected, " 1") || expected == "1" {
+		noun = "argument"
+	}
+	err := newTypeError(callSite, "Function %s expects %s %s but got %d", fn.name, expected, noun, count)
+	return err.withNote(fn.declaredAt, "'%s' is declared here", fn.name)
+}
+func (m MemberExpr) evaluate(env *Env) (RuntimeVal, error) {
+	slot, err := m.resolveSlot(env)
+	if err != nil {
+		return nil, err
+	}
+	return m.get(slot)
 }
-func (m MemberExpr) evaluate(env *Env) RuntimeVal {
-	obj := m.object.evaluate(env)
 
-	switch obj := obj.(type) {
-	case Object:
-		if !m.computed {
-			propName, ok := m.property.(Identifier)
-			if !ok {
-				fmt.Println("Invalid property")
-				os.Exit(1)
-			}
-			prop, ok := obj.properties[propName.symbol]
-			if !ok {
-				fmt.Printf("Propety %v does not exist\n", propName.symbol)
-				os.Exit(1)
-			}
+// memberSlot is the object property or array element a member expression
+// points at. Objects and arrays are shared by reference, so setting a slot is
+// visible through every variable holding them.
+type memberSlot struct {
+	object RuntimeVal
+	key    string
+	index  int64
+}
 
-			return prop
-		}
+func (m MemberExpr) resolveSlot(env *Env) (memberSlot, error) {
+	obj, err := m.object.evaluate(env)
+	if err != nil {
+		return memberSlot{}, err
+	}
 
-		propName, ok := m.property.evaluate(env).(StringVaL)
-		if !ok {
-			fmt.Printf("Object property must me of type string. %v\n", propName)
-			os.Exit(1)
-		}
-		prop, ok := obj.properties[propName.value]
+	switch obj := obj.(type) {
+	case Object:
+		key, err := m.propertyKey(env)
+		return memberSlot{object: obj, key: key}, err
+	case Array:
+		index, err := m.arrayIndex(env, obj)
+		return memberSlot{object: obj, index: index}, err
+	case ErrorVal:
+		key, err := m.propertyKey(env)
+		return memberSlot{object: obj, key: key}, err
+	default:
+		return memberSlot{}, newTypeError(m.object.getSpan(), "Unsuported member expression: %v is not an object or array", obj.getType())
+	}
+}
+func (m MemberExpr) get(slot memberSlot) (RuntimeVal, error) {
+	switch obj := slot.object.(type) {
+	case Object:
+		prop, ok := obj.properties[slot.key]
 		if !ok {
-			fmt.Printf("Propety %v does not exist\n", propName.value)
-			os.Exit(1)
+			err := newReferenceError(m.property.getSpan(), "Property %v does not exist", slot.key)
+			return nil, err.withSuggestion(slot.key, obj.keys())
 		}
-		return prop
+		return prop, nil
+	case ErrorVal:
+		return m.get(memberSlot{object: Object{obj.properties()}, key: slot.key})
+	default:
+		return obj.(Array).elements[slot.index], nil
+	}
+}
+func (m MemberExpr) set(slot memberSlot, value RuntimeVal) error {
+	switch obj := slot.object.(type) {
+	case Object:
+		obj.properties[slot.key] = value
 	case Array:
-		if !m.computed {
-			panic("To get array element you need to use []")
-		}
-		prop := m.property.evaluate(env)
-		index, ok := prop.(NumberVal)
+		obj.elements[slot.index] = value
+	default:
+		return newTypeError(m.span, "Cannot assign to %s, properties of %s are read-only", slot.key, obj.getType())
+	}
+	return nil
+}
+
+// propertyKey returns the name of the object property, from `obj.key` or `obj["key"]`.
+func (m MemberExpr) propertyKey(env *Env) (string, error) {
+	if !m.computed {
+		propName, ok := m.property.(Identifier)
 		if !ok {
-			panic(fmt.Sprintf("Expected number as an array index and get: %v", prop.getType()))
-		}
-		if index.value >= int64(len(obj.elements)) {
-			panic(fmt.Sprintf("Array index out of bounds. Attempted to access index %v in an array of size %v.", index.value, len(obj.elements)))
+			return "", newSyntaxError(m.property.getSpan(), "Invalid property %v", m.property)
 		}
-		return obj.elements[index.value]
+		return propName.symbol, nil
+	}
 
-	default:
-		panic(fmt.Sprintf("Unsuported member expression: %v is not an object or array\n", obj.getType()))
+	val, err := m.property.evaluate(env)
+	if err != nil {
+		return "", err
+	}
+	propName, ok := val.(StringVaL)
+	if !ok {
+		return "", newTypeError(m.property.getSpan(), "Object property must be of type string, got %s", val.getType())
+	}
+	return propName.value, nil
+}
+
+// arrayIndex evaluates the index of `arr[index]` and checks that it is in range.
+func (m MemberExpr) arrayIndex(env *Env, arr Array) (int64, error) {
+	if !m.computed {
+		return 0, newTypeError(m.span, "To get array element you need to use []")
+	}
+	prop, err := m.property.evaluate(env)
+	if err != nil {
+		return 0, err
+	}
+	index, ok := prop.(NumberVal)
+	if !ok {
+		return 0, newTypeError(m.property.getSpan(), "Expected number as an array index and get: %v", prop.getType())
+	}
+	if index.isFloat {
+		return 0, newTypeError(m.property.getSpan(), "Array index must be an integer, got %v", index.floatValue)
+	}
+	if index.value < 0 || index.value >= int64(len(arr.elements)) {
+		return 0, newRangeError(m.property.getSpan(), "Array index out of bounds. Attempted to access index %v in an array of size %v.", index.value, len(arr.elements))
 	}
+	return index.value, nil
 }
-func (u UnaryExpression) evaluate(env *Env) RuntimeVal {
+func (u UnaryExpression) evaluate(env *Env) (RuntimeVal, error) {
+	operand, err := u.operand.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
 
 	switch u.operator {
 	case "!":
-		operand := u.operand.evaluate(env)
-		boolean, ok := operand.(BooleanVal)
+		value, ok := env.toCondition(operand)
 		if !ok {
-			fmt.Printf("invalid operation: operator ! not defined on type %s\n", operand.getType())
-			os.Exit(1)
+			return nil, newTypeError(u.operand.getSpan(), "invalid operation: operator ! not defined on type %s", operand.getType())
 		}
-		return BooleanVal{value: !boolean.value}
+		return BooleanVal{value: !value}, nil
+	case "-", "+":
+		number, ok := operand.(NumberVal)
+		if !ok {
+			return nil, newTypeError(u.operand.getSpan(), "invalid operation: operator %s not defined on type %s", u.operator, operand.getType())
+		}
+		if u.operator == "-" {
+			return NumberVal{value: -number.value, floatValue: -number.floatValue, isFloat: number.isFloat}, nil
+		}
+		return number, nil
 	default:
-		panic(fmt.Sprintf("Not implementet evaluation for this operator: %v\n", u.operator))
+		return nil, newSyntaxError(u.span, "Not implemented evaluation for this operator: %v", u.operator)
 
 	}
 }
-func (b BooleanExpr) evaluate(env *Env) RuntimeVal {
-	lhs := b.left.evaluate(env)
-	rhs := b.right.evaluate(env)
-
-	if !compareTypes(lhs, rhs) {
-		fmt.Printf("invalid operation: %v %v %v (mismatched types %v and %v)\n", lhs, b.operator, rhs, lhs.getType(), rhs.getType())
-		os.Exit(1)
+func (b BooleanExpr) evaluate(env *Env) (RuntimeVal, error) {
+	lhs, err := b.left.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := b.right.evaluate(env)
+	if err != nil {
+		return nil, err
 	}
 
 	switch b.operator {
-	case "==":
-		switch lhs := lhs.(type) {
-		case NullVal:
-			return BooleanVal{value: true}
-		case NumberVal:
-			return BooleanVal{value: lhs.value == rhs.(NumberVal).value}
-		case StringVaL:
-			return BooleanVal{value: lhs.value == rhs.(StringVaL).value}
-		case BooleanVal:
-			return BooleanVal{value: lhs.value == rhs.(BooleanVal).value}
-		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
-		}
-	case "!=":
-		switch lhs := lhs.(type) {
-		case NullVal:
-			return BooleanVal{value: true}
-		case NumberVal:
-			return BooleanVal{value: lhs.value != rhs.(NumberVal).value}
-		case StringVaL:
-			return BooleanVal{value: lhs.value != rhs.(StringVaL).value}
-		case BooleanVal:
-			return BooleanVal{value: lhs.value != rhs.(BooleanVal).value}
-		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
-		}
-	case ">":
-		switch lhs := lhs.(type) {
-		case NumberVal:
-			return BooleanVal{value: lhs.value > rhs.(NumberVal).value}
-		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
-		}
-	case "<":
-		switch lhs := lhs.(type) {
-		case NumberVal:
-			return BooleanVal{value: lhs.value < rhs.(NumberVal).value}
-		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
+	case "==", "!=":
+		equal, err := equals(lhs, rhs, b.operator, b.span)
+		if err != nil {
+			return nil, err
 		}
-	case "<=":
-		switch lhs := lhs.(type) {
-		case NumberVal:
-			return BooleanVal{value: lhs.value <= rhs.(NumberVal).value}
-		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
+		return BooleanVal{value: equal == (b.operator == "==")}, nil
+	case "<", ">", "<=", ">=":
+		if !compareTypes(lhs, rhs) {
+			return nil, newTypeError(b.span, "invalid operation: %v %v %v (mismatched types %v and %v)", quotedText(lhs), b.operator, quotedText(rhs), lhs.getType(), rhs.getType())
 		}
-	case ">=":
 		switch lhs := lhs.(type) {
 		case NumberVal:
-			return BooleanVal{value: lhs.value >= rhs.(NumberVal).value}
+			return BooleanVal{value: lhs.compare(b.operator, rhs.(NumberVal))}, nil
+		case StringVaL:
+			return BooleanVal{value: compareOrdered(b.operator, lhs.value, rhs.(StringVaL).value)}, nil
 		default:
-			fmt.Printf("This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
-			os.Exit(1)
+			return nil, newTypeError(b.span, "This operations is not supported on this type (%s %s %s)", lhs.getType(), b.operator, rhs.getType())
 		}
 	default:
-		fmt.Printf("Invalid operator: %s", b.operator)
-		os.Exit(1)
+		return nil, newSyntaxError(b.span, "Invalid operator: %s", b.operator)
 	}
+}
 
-	panic("Unreachable code")
+// equals implements `==` and `!=`. Any value can be compared with null;
+// other values must have the same type.
+func equals(lhs, rhs RuntimeVal, operator string, span lexer.Span) (bool, error) {
+	_, lhsNull := lhs.(NullVal)
+	_, rhsNull := rhs.(NullVal)
+	if !compareTypes(lhs, rhs) && !lhsNull && !rhsNull {
+		return false, newTypeError(span, "invalid operation: %v %v %v (mismatched types %v and %v)", quotedText(lhs), operator, quotedText(rhs), lhs.getType(), rhs.getType())
+	}
+	return valuesEqual(lhs, rhs), nil
 }
-func (b BinaryExpr) evaluate(env *Env) RuntimeVal {
-	lhs := b.left.evaluate(env)
-	rhs := b.right.evaluate(env)
+func (c ConditionalExpr) evaluate(env *Env) (RuntimeVal, error) {
+	condition, err := evaluateCondition(c.condition, env, "Ternary")
+	if err != nil {
+		return nil, err
+	}
+	if condition {
+		return c.consequent.evaluate(env)
+	}
+	return c.alternative.evaluate(env)
+}
+func (l LogicalExpr) evaluate(env *Env) (RuntimeVal, error) {
+	lhs, err := l.left.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	left, ok := env.toCondition(lhs)
+	if !ok {
+		return nil, newTypeError(l.left.getSpan(), "invalid operation: operator %s not defined on type %s", l.operator, lhs.getType())
+	}
 
+	// The right side is only evaluated when the left one does not decide the
+	// result. Like the left side, it is returned as it is, so `name || "anonymous"`
+	// picks the first truthy value.
+	if l.operator == "&&" && !left || l.operator == "||" && left {
+		return lhs, nil
+	}
+
+	rhs, err := l.right.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := env.toCondition(rhs); !ok {
+		return nil, newTypeError(l.right.getSpan(), "invalid operation: operator %s not defined on type %s", l.operator, rhs.getType())
+	}
+	return rhs, nil
+}
+func (b BinaryExpr) evaluate(env *Env) (RuntimeVal, error) {
+	lhs, err := b.left.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := b.right.evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateBinary(lhs, rhs, b.operator, b.span)
+}
+
+// evaluateBinary applies an arithmetic operator, shared by binary expressions
+// and compound assignments.
+func evaluateBinary(lhs, rhs RuntimeVal, operator string, span lexer.Span) (RuntimeVal, error) {
 	if !compareTypes(lhs, rhs) {
-		fmt.Printf("invalid operation: %v %v %v (mismatched types %v and %v)\n", lhs, b.operator, rhs, lhs.getType(), rhs.getType())
-		os.Exit(1)
+		return nil, newTypeError(span, "invalid operation: %v %v %v (mismatched types %v and %v)", quotedText(lhs), operator, quotedText(rhs), lhs.getType(), rhs.getType())
 	}
 
 	switch lhs := lhs.(type) {
 	case NumberVal:
-		return lhs.binaryOperation(b.operator, rhs.(NumberVal))
+		val, err := lhs.binaryOperation(operator, rhs.(NumberVal))
+		return val, withSpan(err, span)
 	case StringVaL:
-		return lhs.binaryOperation(b.operator, rhs.(StringVaL))
+		val, err := lhs.binaryOperation(operator, rhs.(StringVaL))
+		return val, withSpan(err, span)
 	}
 
-	panic(fmt.Sprintf("unsuportet operation: %v %v %v\n", lhs, b.operator, rhs))
+	return nil, newTypeError(span, "unsupported operation: %v %v %v", quotedText(lhs), operator, quotedText(rhs))
 }
-func (i Identifier) evaluate(env *Env) RuntimeVal {
-	val := env.lookupVar(i.symbol)
-
-	return val
+func (i Identifier) evaluate(env *Env) (RuntimeVal, error) {
+	val, err := env.lookupVar(i.symbol)
+	return val, withSpan(err, i.span)
 }
-func (n NumericLiteral) evaluate(_ *Env) RuntimeVal {
-	return NumberVal(n)
+func (n NumericLiteral) evaluate(_ *Env) (RuntimeVal, error) {
+	return NumberVal{value: n.value, floatValue: n.floatValue, isFloat: n.isFloat}, nil
 }
-func (s StringLiteral) evaluate(env *Env) RuntimeVal {
-	return StringVaL(s)
+func (s StringLiteral) evaluate(env *Env) (RuntimeVal, error) {
+	return StringVaL{value: s.value}, nil
+}
+func (a ArrayLiteral) evaluate(env *Env) (RuntimeVal, error) {
+	elements, err := evaluateList(a.elements, env)
+	if err != nil {
+		return nil, err
+	}
+	return Array{elements}, nil
+}
+func (s SpreadExpr) evaluate(env *Env) (RuntimeVal, error) {
+	return nil, newSyntaxError(s.span, "Spread is only allowed in function arguments and array literals")
 }
-func (a ArrayLiteral) evaluate(env *Env) RuntimeVal {
-	elemements := make([]RuntimeVal, len(a.elements))
 
-	for i, elem := range a.elements {
-		elemements[i] = elem.evaluate(env)
+// evaluateList evaluates call arguments or array elements, expanding spread
+// arrays into their elements.
+func evaluateList(exprs []Expr, env *Env) ([]RuntimeVal, error) {
+	values := make([]RuntimeVal, 0, len(exprs))
+
+	for _, expr := range exprs {
+		spread, ok := expr.(SpreadExpr)
+		if !ok {
+			val, err := expr.evaluate(env)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, val)
+			continue
+		}
+
+		val, err := spread.argument.evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		array, ok := val.(Array)
+		if !ok {
+			return nil, newTypeError(spread.argument.getSpan(), "Cannot spread %s, expected an array", val.getType())
+		}
+		values = append(values, array.elements...)
 	}
+	return values, nil
+}
+func (t TemplateLiteral) evaluate(env *Env) (RuntimeVal, error) {
+	var str strings.Builder
 
-	return Array{elemements}
+	for _, part := range t.parts {
+		val, err := part.evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		str.WriteString(toText(val))
+	}
+
+	return StringVaL{value: str.String()}, nil
+}
+
+// evaluateBody evaluates the statements of a block in order and returns the
+// value of the last one.
+func evaluateBody(body []Stmt, env *Env) (RuntimeVal, error) {
+	var result RuntimeVal = NullVal{}
+
+	for _, stmt := range body {
+		val, err := stmt.evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		result = val
+	}
+	return result, nil
 }
 
 func (p Program) String() string {
@@ -405,7 +1006,7 @@ func (v VarDeclaration) String() string {
 
 }
 func (a AssigmentExpr) String() string {
-	return fmt.Sprintf("AssigmentExpr{assigne: %+v,value: %+v}", a.assigne, a.value)
+	return fmt.Sprintf("AssigmentExpr{assigne: %+v,operator: %v,value: %+v}", a.assigne, a.operator, a.value)
 }
 func (m MemberExpr) String() string {
 	return fmt.Sprintf("MemberExpr{object:%v, property:%v, computed:%v}", m.object, m.property, m.computed)
@@ -425,9 +1026,15 @@ func (b BinaryExpr) String() string {
 	return fmt.Sprintf("BinaryExpr{left:%v right:%v operator:'%v'}", b.left, b.right, b.operator)
 }
 
+func (l LogicalExpr) String() string {
+	return fmt.Sprintf("LogicalExpr{left:%v right:%v operator:'%v'}", l.left, l.right, l.operator)
+}
 func (i Identifier) String() string {
 	return fmt.Sprintf("Identifier{symbol:'%v'}", i.symbol)
 }
 func (n NumericLiteral) String() string {
+	if n.isFloat {
+		return fmt.Sprintf("%v", n.floatValue)
+	}
 	return fmt.Sprintf("%v", n.value)
 }
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestMatchArmsOfAnotherType(t *testing.T) {
+	expectValue(t, `let r = null; match ("a") { 1 => r = "one", "a" => r = "letter a" }
+		r`, `"letter a"`)
+	expectValue(t, `let r = null; match (null) { 0 => r = "zero" else => r = "null" }
+		r`, `"null"`)
+}
+
+func TestThisOutsideMethodCalls(t *testing.T) {
+	expectValue(t, "this", "null")
+	expectValue(t, "let f = () => this; f()", "null")
+	expectValue(t, "fn g() { this } g()", "null")
+	expectValue(t, "let o = { f: fn() { () => this } }; o.f()() == o", "true")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IgorM867/interpreter-in-go/colors"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStackTraceFrames limits how many calls of a stack trace are printed, so
+// runaway recursion does not flood the output.
+const maxStackTraceFrames = 20
+
+// formatDiagnostic renders an error compiler-style: a header with the file
+// position, the offending source line with the span underlined, then any
+// notes and hints. Errors without a position are rendered as plain text.
+func formatDiagnostic(err error, fileName string, source string) string {
+	var errs ErrorList
+	if errors.As(err, &errs) {
+		diagnostics := make([]string, len(errs))
+		for i, err := range errs {
+			diagnostics[i] = formatDiagnostic(err, fileName, source)
+		}
+		if len(errs) > 1 {
+			diagnostics = append(diagnostics, colors.RedString(fmt.Sprintf("%d errors found", len(errs))))
+		}
+		return strings.Join(diagnostics, "\n\n")
+	}
+
+	var interpreterErr *InterpreterError
+	if !errors.As(err, &interpreterErr) {
+		return colors.RedString("error") + ": " + err.Error()
+	}
+
+	var str strings.Builder
+	str.WriteString(colors.RedString(fmt.Sprintf("error[%v]", interpreterErr.Kind)))
+	str.WriteString(": " + interpreterErr.Message + "\n")
+	writeSnippet(&str, fileName, source, interpreterErr.Span, colors.RedString)
+
+	for _, note := range interpreterErr.Notes {
+		str.WriteString(colors.CyanString("note") + ": " + note.Message + "\n")
+		writeSnippet(&str, fileName, source, note.Span, colors.CyanString)
+	}
+	if interpreterErr.Help != "" {
+		str.WriteString(colors.GreenString("help") + ": " + interpreterErr.Help + "\n")
+	}
+	if len(interpreterErr.Stack) > 0 {
+		str.WriteString(colors.BlueString("stack trace") + ":\n")
+		for i, frame := range interpreterErr.Stack {
+			if i == maxStackTraceFrames {
+				str.WriteString(fmt.Sprintf("    ... %d more calls\n", len(interpreterErr.Stack)-i))
+				break
+			}
+			str.WriteString(fmt.Sprintf("    at %s (%s:%v)\n", frame.name, fileName, frame.callSite.Start))
+		}
+	}
+
+	return strings.TrimSuffix(str.String(), "\n")
+}
+
+// writeSnippet writes the location of span and the source line it starts on,
+// underlined from the start of the span to its end or the end of the line.
+func writeSnippet(str *strings.Builder, fileName string, source string, span lexer.Span, color func(string) string) {
+	if span.IsZero() {
+		return
+	}
+
+	lines := strings.Split(source, "\n")
+	lineNumber := int(span.Start.Line)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(lineNumber)))
+	str.WriteString(fmt.Sprintf("%s %s %s:%v\n", gutter, colors.BlueString("-->"), fileName, span.Start))
+	if lineNumber < 1 || lineNumber > len(lines) {
+		return
+	}
+
+	line := []rune(strings.TrimRight(lines[lineNumber-1], "\r"))
+	start := int(span.Start.Column) - 1
+	end := len(line)
+	if span.End.Line == span.Start.Line {
+		end = int(span.End.Column) - 1
+	}
+	start = min(max(start, 0), len(line))
+	end = min(max(end, start+1), len(line)+1)
+
+	// Tabs are kept under the source so the underline stays aligned.
+	padding := []rune(strings.Repeat(" ", start))
+	for i := range padding {
+		if line[i] == '\t' {
+			padding[i] = '\t'
+		}
+	}
+
+	str.WriteString(fmt.Sprintf("%s %s\n", gutter, colors.BlueString("|")))
+	str.WriteString(fmt.Sprintf("%s %s %s\n", colors.BlueString(fmt.Sprint(lineNumber)), colors.BlueString("|"), string(line)))
+	str.WriteString(fmt.Sprintf("%s %s %s%s\n", gutter, colors.BlueString("|"), string(padding), color(strings.Repeat("^", end-start))))
+}
+
+// closestName returns the candidate with the smallest edit distance to name,
+// provided it is close enough to be a likely typo. Names shorter than three
+// characters get no suggestion, since any short name is close to them.
+func closestName(name string, candidates []string) (string, bool) {
+	length := utf8.RuneCountInString(name)
+	if length < 3 {
+		return "", false
+	}
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	best := ""
+	bestDistance := min(max(1, (length+2)/3)+1, length)
+	for _, candidate := range sorted {
+		if candidate == name {
+			continue
+		}
+		if distance := editDistance(name, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the optimal string alignment distance between a and b: the
+// number of insertions, deletions, substitutions and swaps of neighbouring
+// characters needed to turn one into the other.
+func editDistance(a, b string) int {
+	first, second := []rune(a), []rune(b)
+	distances := make([][]int, len(first)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(second)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			distances[i][j] = min(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+			if i > 1 && j > 1 && first[i-1] == second[j-2] && first[i-2] == second[j-1] {
+				distances[i][j] = min(distances[i][j], distances[i-2][j-2]+1)
+			}
+		}
+	}
+	return distances[len(first)][len(second)]
+}
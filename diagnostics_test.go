@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestClosestName(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"coutn", []string{"count", "print"}, "count"},
+		{"y", []string{"f", "x"}, ""},
+		{"ab", []string{"a", "abc"}, ""},
+		{"abc", []string{"xyz"}, ""},
+		{"prnt", []string{"print", "println"}, "print"},
+	}
+
+	for _, test := range tests {
+		got, ok := closestName(test.name, test.candidates)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("closestName(%q): got %q, %v, want %q", test.name, got, ok, test.want)
+		}
+	}
+}
@@ -2,29 +2,71 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"math"
 )
 
 type Variable struct {
 	runtimeVal RuntimeVal
 	constant   bool
+	// declaredAt is where the variable was declared, zero for built-in names.
+	declaredAt lexer.Span
 }
 
 type Env struct {
 	parent    *Env
 	variables map[string]Variable
+	// options and callStack are shared by every scope created from the same
+	// global environment.
+	options   *Options
+	callStack *CallStack
 }
 
-func createGlobalEnv() Env {
+// CallStack lists the calls to script functions being evaluated, innermost last.
+type CallStack struct {
+	frames []Frame
+}
+
+// Frame is one call on the call stack: the called function and where it was called.
+type Frame struct {
+	name     string
+	callSite lexer.Span
+}
+
+// Options are the interpreter settings chosen on the command line.
+type Options struct {
+	// strict requires conditions and the operands of !, && and || to be
+	// booleans instead of converting other values by their truthiness.
+	strict bool
+	// maxCallDepth is how many function calls can be nested before a call
+	// raises a RangeError instead of overflowing the Go stack.
+	maxCallDepth int
+}
+
+const (
+	defaultMaxCallDepth = 10000
+	// maxCallDepthLimit is the largest -max-depth accepted. Deeper limits
+	// could overflow the Go stack before the RangeError is raised.
+	maxCallDepthLimit = 100000
+	// maxGoStack is the Go stack size allowed for evaluation, leaving room
+	// for maxCallDepthLimit calls that each nest several statements.
+	maxGoStack = min(4<<30, math.MaxInt)
+)
+
+func createGlobalEnv(options Options) Env {
 	newEnv := Env{
 		parent:    nil,
 		variables: make(map[string]Variable),
+		options:   &options,
+		callStack: &CallStack{},
 	}
 	newEnv.declareVar("false", BooleanVal{value: false}, true)
 	newEnv.declareVar("true", BooleanVal{value: true}, true)
 	newEnv.declareVar("null", NullVal{}, true)
+	newEnv.declareVar("this", NullVal{}, true)
 	newEnv.declareVar("print", NativeFn{call: nativePrint}, true)
 	newEnv.declareVar("println", NativeFn{call: nativePrintln}, true)
+	newEnv.declareVar("Error", NativeFn{call: nativeError}, true)
 
 	return newEnv
 }
@@ -32,43 +74,112 @@ func newScope(parent *Env) Env {
 	newEnv := Env{
 		parent:    parent,
 		variables: make(map[string]Variable),
+		options:   parent.options,
+		callStack: parent.callStack,
+	}
+	return newEnv
+}
+
+// copyScope returns a new scope with the same parent and a copy of this
+// scope's variables, so closures created before the copy keep the old values.
+func (env *Env) copyScope() Env {
+	newEnv := newScope(env.parent)
+	for name, variable := range env.variables {
+		newEnv.variables[name] = variable
 	}
 	return newEnv
 }
 func (env *Env) declareVar(varname string, value RuntimeVal, isConst bool) (RuntimeVal, error) {
-	if _, ok := env.variables[varname]; ok {
-		return nil, fmt.Errorf("cannot declare variable %s. As it already is defined", varname)
+	return env.declareVarAt(varname, value, isConst, lexer.Span{})
+}
+
+// declareVarAt declares a variable and remembers where in the source it was declared.
+func (env *Env) declareVarAt(varname string, value RuntimeVal, isConst bool, span lexer.Span) (RuntimeVal, error) {
+	if existing, ok := env.variables[varname]; ok {
+		err := newReferenceError(lexer.Span{}, "Cannot declare variable %s. As it already is defined", varname)
+		return nil, err.withNote(existing.declaredAt, "'%s' was first declared here", varname)
 	}
 
-	env.variables[varname] = Variable{runtimeVal: value, constant: isConst}
+	env.variables[varname] = Variable{runtimeVal: value, constant: isConst, declaredAt: span}
 	return value, nil
 }
-func (env *Env) assignVar(varname string, value RuntimeVal) RuntimeVal {
-	varEnv := env.resolve(varname)
+func (env *Env) assignVar(varname string, value RuntimeVal) (RuntimeVal, error) {
+	varEnv, err := env.resolve(varname)
+	if err != nil {
+		return nil, err
+	}
 
 	v := varEnv.variables[varname]
 	if v.constant {
-		fmt.Println("Cannot reasign constant variable:", varname)
-		os.Exit(1)
+		err := newTypeError(lexer.Span{}, "Cannot reasign constant variable: %s", varname)
+		return nil, err.withNote(v.declaredAt, "'%s' was declared constant here", varname)
+	}
+	varEnv.variables[varname] = Variable{runtimeVal: value, constant: false, declaredAt: v.declaredAt}
+
+	return value, nil
+}
+func (env *Env) lookupVar(varname string) (RuntimeVal, error) {
+	e, err := env.resolve(varname)
+	if err != nil {
+		return nil, err
 	}
-	varEnv.variables[varname] = Variable{runtimeVal: value, constant: false}
 
-	return value
+	return e.variables[varname].runtimeVal, nil
 }
-func (env *Env) lookupVar(varname string) RuntimeVal {
-	e := env.resolve(varname)
 
-	return e.variables[varname].runtimeVal
+func (env *Env) resolve(varname string) (*Env, error) {
+	for e := env; e != nil; e = e.parent {
+		if _, ok := e.variables[varname]; ok {
+			return e, nil
+		}
+	}
+
+	err := newReferenceError(lexer.Span{}, "Cannot resolve '%s' as it does not exist", varname)
+	return nil, err.withSuggestion(varname, env.visibleNames())
 }
 
-func (env *Env) resolve(varname string) Env {
-	if _, ok := env.variables[varname]; ok {
-		return *env
+// visibleNames lists the names declared in this scope and all of its parents.
+func (env *Env) visibleNames() []string {
+	names := make([]string, 0)
+
+	for e := env; e != nil; e = e.parent {
+		for name := range e.variables {
+			names = append(names, name)
+		}
 	}
-	if env.parent == nil {
-		fmt.Printf("Cannot resolve '%s' as it does not exist\n", varname)
-		os.Exit(1)
+	return names
+}
+
+func (stack *CallStack) push(name string, callSite lexer.Span) {
+	stack.frames = append(stack.frames, Frame{name: name, callSite: callSite})
+}
+func (stack *CallStack) pop() {
+	stack.frames = stack.frames[:len(stack.frames)-1]
+}
+
+// trace returns a copy of the active calls, innermost first.
+func (stack *CallStack) trace() []Frame {
+	frames := make([]Frame, len(stack.frames))
+	for i, frame := range stack.frames {
+		frames[len(frames)-1-i] = frame
 	}
+	return frames
+}
 
-	return env.parent.resolve(varname)
+func (frame Frame) String() string {
+	return fmt.Sprintf("%s (%v)", frame.name, frame.callSite.Start)
+}
+
+// toCondition converts a value used as a condition to a boolean. Without
+// strict mode null, false, 0, "" and empty arrays are false and every other
+// value is true. In strict mode only booleans are accepted and ok is false
+// for any other value.
+func (env *Env) toCondition(val RuntimeVal) (value bool, ok bool) {
+	if boolean, isBool := val.(BooleanVal); isBool {
+		return boolean.value, true
+	}
+	if env.options.strict {
+		return false, false
+	}
+	return isTruthy(val), true
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	SyntaxError ErrorKind = iota
+	ReferenceError
+	TypeError
+	RangeError
+	// GenericError is the kind of errors created by scripts with Error().
+	GenericError
+)
+
+// InterpreterError is returned by produceAst and Program.evaluate instead of
+// terminating the process, so callers decide how to report it.
+type InterpreterError struct {
+	Kind    ErrorKind
+	Message string
+	// Span is the part of the source the error points at, zero when it is unknown.
+	Span  lexer.Span
+	Notes []Note
+	// Help is a hint on how to fix the error, such as a name suggestion.
+	Help string
+	// Value is the value passed to throw, nil for errors raised by the interpreter.
+	Value RuntimeVal
+	// Stack is the call stack where the error was raised, innermost call first.
+	// It is nil until the error is seen by a function call or a catch clause.
+	Stack []Frame
+}
+
+// ErrorList holds every syntax error found in a source, in source order.
+type ErrorList []*InterpreterError
+
+// Note points at a second place in the source that explains an error.
+type Note struct {
+	Message string
+	Span    lexer.Span
+}
+
+func (kind ErrorKind) String() string {
+	return []string{"SyntaxError", "ReferenceError", "TypeError", "RangeError", "Error"}[kind]
+}
+func (e *InterpreterError) Error() string {
+	if e.Span.IsZero() {
+		return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%v: %s (line %d, column %d)", e.Kind, e.Message, e.Span.Start.Line, e.Span.Start.Column)
+}
+func (list ErrorList) Error() string {
+	messages := make([]string, len(list))
+	for i, err := range list {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+func (list *ErrorList) add(err error) {
+	var errs ErrorList
+	var interpreterErr *InterpreterError
+	if errors.As(err, &errs) {
+		*list = append(*list, errs...)
+	} else if errors.As(err, &interpreterErr) {
+		*list = append(*list, interpreterErr)
+	} else {
+		*list = append(*list, &InterpreterError{Kind: SyntaxError, Message: err.Error()})
+	}
+}
+
+// thrownError wraps a value passed to throw so it travels up like any other
+// runtime error until a try statement catches it.
+func thrownError(value RuntimeVal, span lexer.Span) *InterpreterError {
+	if errVal, ok := value.(ErrorVal); ok {
+		if errVal.span.IsZero() {
+			errVal.span = span
+		}
+		return &InterpreterError{Kind: errVal.kind, Message: errVal.message, Span: errVal.span, Value: errVal, Stack: errVal.stack}
+	}
+	return &InterpreterError{Kind: GenericError, Message: "Uncaught " + quotedText(value), Span: span, Value: value}
+}
+
+// toValue returns the value a catch clause receives for the error.
+func (e *InterpreterError) toValue() RuntimeVal {
+	if errVal, ok := e.Value.(ErrorVal); ok {
+		errVal.stack = e.Stack
+		return errVal
+	}
+	if e.Value != nil {
+		return e.Value
+	}
+	return ErrorVal{kind: e.Kind, message: e.Message, span: e.Span, stack: e.Stack}
+}
+
+func newSyntaxError(span lexer.Span, format string, a ...any) *InterpreterError {
+	return &InterpreterError{Kind: SyntaxError, Message: fmt.Sprintf(format, a...), Span: span}
+}
+func newReferenceError(span lexer.Span, format string, a ...any) *InterpreterError {
+	return &InterpreterError{Kind: ReferenceError, Message: fmt.Sprintf(format, a...), Span: span}
+}
+func newTypeError(span lexer.Span, format string, a ...any) *InterpreterError {
+	return &InterpreterError{Kind: TypeError, Message: fmt.Sprintf(format, a...), Span: span}
+}
+func newRangeError(span lexer.Span, format string, a ...any) *InterpreterError {
+	return &InterpreterError{Kind: RangeError, Message: fmt.Sprintf(format, a...), Span: span}
+}
+
+// withNote adds a note pointing at span, unless the span is unknown.
+func (e *InterpreterError) withNote(span lexer.Span, format string, a ...any) *InterpreterError {
+	if !span.IsZero() {
+		e.Notes = append(e.Notes, Note{Message: fmt.Sprintf(format, a...), Span: span})
+	}
+	return e
+}
+
+// withSuggestion adds a "did you mean" hint when one of the candidates is
+// close enough to the misspelled name.
+func (e *InterpreterError) withSuggestion(name string, candidates []string) *InterpreterError {
+	if suggestion, ok := closestName(name, candidates); ok {
+		e.Help = fmt.Sprintf("did you mean '%s'?", suggestion)
+	}
+	return e
+}
+
+// withSpan points errors raised where no source position is known, such as
+// inside Env, at the node that caused them.
+func withSpan(err error, span lexer.Span) error {
+	var interpreterErr *InterpreterError
+	if errors.As(err, &interpreterErr) && interpreterErr.Span.IsZero() {
+		interpreterErr.Span = span
+	}
+	return err
+}
+
+// withStack records the call stack on errors that do not have one yet. It
+// runs before any call is popped off the stack, so the recorded stack is the
+// one at the point the error was raised.
+func withStack(err error, stack *CallStack) error {
+	var interpreterErr *InterpreterError
+	if errors.As(err, &interpreterErr) && interpreterErr.Stack == nil {
+		interpreterErr.Stack = stack.trace()
+	}
+	return err
+}
+
+// fromLexerError converts errors reported by the lexer package into a SyntaxError.
+func fromLexerError(err error) error {
+	var lexErr *lexer.Error
+	if errors.As(err, &lexErr) {
+		return newSyntaxError(lexErr.Span, "%s", lexErr.Message)
+	}
+	return err
+}
@@ -1,3 +1,3 @@
-module main
+module github.com/IgorM867/interpreter-in-go
 
 go 1.22.5
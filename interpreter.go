@@ -1,16 +1,131 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"runtime/debug"
 )
 
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const usage = `Usage:
+  interpreter run <file> [args...]   run a script file
+  interpreter -e '<code>' [args...]  run inline code
+  interpreter repl                   start an interactive session
+  interpreter [-] [args...]          read the script from stdin
+
+Without arguments the REPL starts when stdin is a terminal.
+
+Flags:
+`
+
 func main() {
-	env := createGlobalEnv()
+	os.Exit(runCli(os.Args[1:], os.Stdin, os.Stderr))
+}
+
+func runCli(cliArgs []string, stdin io.Reader, stderr io.Writer) int {
+	debug.SetMaxStack(maxGoStack)
+
+	flags := flag.NewFlagSet("interpreter", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	code := flags.String("e", "", "evaluate the given code instead of reading a file")
+	options := Options{}
+	flags.BoolVar(&options.strict, "strict", false, "require booleans in conditions instead of using truthiness")
+	flags.IntVar(&options.maxCallDepth, "max-depth", defaultMaxCallDepth, "maximum depth of nested function calls")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(cliArgs); err != nil {
+		if err == flag.ErrHelp {
+			return exitSuccess
+		}
+		return exitUsage
+	}
+	if options.maxCallDepth < 1 || options.maxCallDepth > maxCallDepthLimit {
+		fmt.Fprintf(stderr, "-max-depth must be between 1 and %d\n", maxCallDepthLimit)
+		return exitUsage
+	}
+	rest := flags.Args()
+
+	if isFlagSet(flags, "e") {
+		return runSource(*code, "<eval>", rest, options, stderr)
+	}
+	if len(rest) > 0 && rest[0] == "run" {
+		if len(rest) < 2 {
+			fmt.Fprintln(stderr, "run: missing script path")
+			flags.Usage()
+			return exitUsage
+		}
+		dat, err := os.ReadFile(rest[1])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		return runSource(string(dat), rest[1], rest[2:], options, stderr)
+	}
+	if len(rest) > 0 && rest[0] == "repl" {
+		repl := newRepl(stdin, os.Stdout, stderr, options)
+		return repl.run()
+	}
+	if len(rest) == 0 {
+		if file, ok := stdin.(*os.File); ok && isTerminal(file) {
+			repl := newRepl(stdin, os.Stdout, stderr, options)
+			return repl.run()
+		}
+	}
+	if len(rest) > 0 && rest[0] == "-" {
+		rest = rest[1:]
+	}
+
+	dat, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	return runSource(string(dat), "<stdin>", rest, options, stderr)
+}
 
-	dat, err := os.ReadFile("test.txt")
+func runSource(sourceCode string, fileName string, scriptArgs []string, options Options, stderr io.Writer) int {
+	env := createGlobalEnv(options)
+	env.declareVar("args", argsArray(scriptArgs), true)
+
+	program, err := produceAst(sourceCode)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(stderr, formatDiagnostic(err, fileName, sourceCode))
+		return exitFailure
+	}
+	if _, err := program.evaluate(&env); err != nil {
+		fmt.Fprintln(stderr, formatDiagnostic(err, fileName, sourceCode))
+		return exitFailure
 	}
-	program := produceAst(string(dat))
-	program.evaluate(&env)
+
+	return exitSuccess
+}
+
+func argsArray(scriptArgs []string) Array {
+	elements := make([]RuntimeVal, len(scriptArgs))
+
+	for i, arg := range scriptArgs {
+		elements[i] = StringVaL{value: arg}
+	}
+
+	return Array{elements}
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	found := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
 }
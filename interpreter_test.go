@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// evalSource parses and evaluates source in a fresh global environment and
+// returns the value of its last statement.
+func evalSource(source string) (RuntimeVal, error) {
+	env := createGlobalEnv(Options{maxCallDepth: defaultMaxCallDepth})
+	program, err := produceAst(source)
+	if err != nil {
+		return nil, err
+	}
+	return program.evaluate(&env)
+}
+
+// expectValue checks that source evaluates to a value printed as want.
+func expectValue(t *testing.T, source string, want string) {
+	t.Helper()
+	val, err := evalSource(source)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", source, err)
+	}
+	if got := quotedText(val); got != want {
+		t.Errorf("%s: got %s, want %s", source, got, want)
+	}
+}
+
+// expectError checks that source fails with an error of the given kind.
+func expectError(t *testing.T, source string, kind ErrorKind) *InterpreterError {
+	t.Helper()
+	_, err := evalSource(source)
+	if err == nil {
+		t.Fatalf("%s: expected a %v, got no error", source, kind)
+	}
+	var list ErrorList
+	if errors.As(err, &list) {
+		err = list[0]
+	}
+	var interpreterErr *InterpreterError
+	if !errors.As(err, &interpreterErr) || interpreterErr.Kind != kind {
+		t.Fatalf("%s: expected a %v, got %v", source, kind, err)
+	}
+	return interpreterErr
+}
+
+func TestMaxDepthFlagRange(t *testing.T) {
+	for _, depth := range []string{"0", "2000000"} {
+		var stderr bytes.Buffer
+		code := runCli([]string{"-max-depth", depth, "-e", "1"}, strings.NewReader(""), &stderr)
+		if code != exitUsage {
+			t.Errorf("-max-depth %s: exit code %d, want %d", depth, code, exitUsage)
+		}
+		if !strings.Contains(stderr.String(), "-max-depth must be between 1 and 100000") {
+			t.Errorf("-max-depth %s: unexpected message %q", depth, stderr.String())
+		}
+	}
+}
+
+func TestRunawayRecursionAtMaxDepthLimit(t *testing.T) {
+	// Every call nests a loop, a try, a match and a second call, so each level
+	// takes far more Go stack than a plain recursive call.
+	source := `
+		fn down(n) {
+			for (x in [n]) {
+				try {
+					match (n % 2) {
+						0 => { return (() => down(n + 1))() }
+						else => { return [down(n + 1)][0] }
+					}
+				} finally { }
+			}
+		}
+		try {
+			down(0)
+		} catch (e) {
+			if (e.kind != "RangeError") { throw e }
+		}`
+	var stderr bytes.Buffer
+	code := runCli([]string{"-max-depth", "100000", "-e", source}, strings.NewReader(""), &stderr)
+	if code != exitSuccess {
+		t.Fatalf("exit code %d, want %d: %s", code, exitSuccess, stderr.String())
+	}
+}
@@ -2,10 +2,10 @@ package lexer
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type TokenType int64
@@ -14,6 +14,7 @@ const (
 	// Literal Type
 	Number TokenType = iota
 	String
+	Template // backtick string with embedded ${...} expressions
 	Identifier
 	// Keywords
 	Let
@@ -21,10 +22,24 @@ const (
 	Fn
 	If
 	Else
+	Match
 	While
+	For
+	In
+	Return
+	Break
+	Continue
+	Throw
+	Try
+	Catch
+	Finally
 	// Grouping * Operators
 	BinaryOperator      // + - * / %
 	Equals              // =
+	CompoundAssign      // += -= *= /= %=
+	Increment           // ++
+	Decrement           // --
+	Arrow               // =>
 	EqualsEquals        // ==
 	NotEquals           // !=
 	LessThanOrEquals    // <=
@@ -32,11 +47,15 @@ const (
 	LessThan            // <
 	GreaterThan         // >
 	Dot                 // .
+	Spread              // ...
 	Coma                // ,
 	Colon               // :
+	QuestionMark        // ?
 	Semicolon           // ;
 	DoubleQuote         // "
 	Not                 // !
+	And                 // &&
+	Or                  // ||
 	Comment             // //
 	OpenParen           // (
 	CloseParen          // )
@@ -47,21 +66,87 @@ const (
 	EOF                 // Signified the end of file
 )
 
+// Position points at a character of the source. Line and Column start at 1,
+// Offset is the byte offset from the start of the source.
+type Position struct {
+	Line   uint64
+	Column uint64
+	Offset int
+}
+
+// Span covers the source from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
 type Token struct {
 	Value     string
 	TokenType TokenType
-	Line      uint64
+	Span      Span
 }
 
-var KEYWORDS = map[string]TokenType{"let": Let, "const": Const, "fn": Fn, "if": If, "else": Else, "while": While}
-var currentLine uint64 = 1
+// Error is returned by Tokenize when the source contains text that cannot
+// be turned into a token.
+type Error struct {
+	Message string
+	Span    Span
+	// Incomplete reports that the source ended inside a backtick string, so
+	// more input could still complete it.
+	Incomplete bool
+}
+
+type scanner struct {
+	src []string
+	// positions[i] is where src[i] starts, the extra last entry is the end of the source.
+	positions []Position
+}
+
+var KEYWORDS = map[string]TokenType{"let": Let, "const": Const, "fn": Fn, "if": If, "else": Else, "match": Match, "while": While, "for": For, "in": In, "return": Return, "break": Break, "continue": Continue, "throw": Throw, "try": Try, "catch": Catch, "finally": Finally}
 
 func (tokenType TokenType) String() string {
 
-	return []string{"Number", "String", "Identifier", "Let", "Const", "Fn", "If", "Else", "While", "BinaryOperator", "Equals", "EqualsEquals", "NotEquals", "LessThanOrEquals", "GreaterThanOrEquals", "LessThan", "GreaterThan", "Dot", "Coma", "Colon", "Semicolon", "DoubleQuote", "Not", "Comment", "OpenParen", "CloseParen", "OpenBrace", "CloseBrace", "OpenBracket", "CloseBracket", "EOF"}[tokenType]
+	return []string{"Number", "String", "Template", "Identifier", "Let", "Const", "Fn", "If", "Else", "Match", "While", "For", "In", "Return", "Break", "Continue", "Throw", "Try", "Catch", "Finally", "BinaryOperator", "Equals", "CompoundAssign", "Increment", "Decrement", "Arrow", "EqualsEquals", "NotEquals", "LessThanOrEquals", "GreaterThanOrEquals", "LessThan", "GreaterThan", "Dot", "Spread", "Coma", "Colon", "QuestionMark", "Semicolon", "DoubleQuote", "Not", "And", "Or", "Comment", "OpenParen", "CloseParen", "OpenBrace", "CloseBrace", "OpenBracket", "CloseBracket", "EOF"}[tokenType]
+}
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s. Line:%v Column:%v", e.Message, e.Span.Start.Line, e.Span.Start.Column)
+}
+func (pos Position) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+func (span Span) IsZero() bool {
+	return span == Span{}
+}
+
+func newScanner(sourceCode string, start Position) scanner {
+	src := strings.Split(sourceCode, "")
+	positions := make([]Position, len(src)+1)
+	positions[0] = start
+
+	for i, char := range src {
+		next := positions[i]
+		next.Offset += len(char)
+		if char == "\n" {
+			next.Line++
+			next.Column = 1
+		} else {
+			next.Column++
+		}
+		positions[i+1] = next
+	}
+
+	return scanner{src: src, positions: positions}
+}
+func (s *scanner) span(start, end int) Span {
+	return Span{Start: s.positions[start], End: s.positions[end]}
+}
+
+// newToken creates a token whose source text is value, starting at src[start].
+func (s *scanner) newToken(value string, tType TokenType, start int) Token {
+	return Token{Value: value, TokenType: tType, Span: s.span(start, start+utf8.RuneCountInString(value))}
 }
-func newToken(value string, tType TokenType) Token {
-	return Token{Value: value, TokenType: tType, Line: currentLine}
+func (s *scanner) error(start, end int, format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Span: s.span(start, end)}
 }
 
 func isInt(char string) bool {
@@ -82,100 +167,325 @@ func isAlphaNumeric(str string) bool {
 	return alphanumeric.MatchString(str)
 }
 func isSkippable(str string) bool {
-	if str == "\n" {
-		currentLine += 1
-		return true
+	return str == " " || str == "\t" || str == "\r" || str == "\n"
+}
+
+var escapes = map[string]string{"n": "\n", "t": "\t", "r": "\r", "0": "\x00", "\\": "\\", `"`: `"`, "'": "'", "`": "`"}
+
+// readQuotedString reads a string delimited by the quote at src[start] and
+// resolves its escape sequences. It returns the index of the closing quote.
+func (s *scanner) readQuotedString(start int) (string, int, error) {
+	src := s.src
+	quote := src[start]
+	str := ""
+
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case quote:
+			return str, i, nil
+		case "\n":
+			return "", i, s.error(start, i, "unterminated string literal")
+		case "\\":
+			if i+1 >= len(src) {
+				return "", i, s.error(start, len(src), "unterminated string literal")
+			}
+			i++
+			if src[i] == "u" {
+				char, end, err := s.readUnicodeEscape(i)
+				if err != nil {
+					return "", i, err
+				}
+				str += char
+				i = end
+				continue
+			}
+			escaped, ok := escapes[src[i]]
+			if !ok {
+				return "", i, s.error(i-1, i+1, "unknown escape sequence: \\%s", src[i])
+			}
+			str += escaped
+		default:
+			str += src[i]
+		}
+	}
+
+	return "", len(src), s.error(start, len(src), "unterminated string literal")
+}
+
+// readUnicodeEscape reads \u{XXXX} where src[start] is the u. It returns the
+// index of the closing brace.
+func (s *scanner) readUnicodeEscape(start int) (string, int, error) {
+	src := s.src
+	if start+1 >= len(src) || src[start+1] != "{" {
+		return "", start, s.error(start-1, start+1, "invalid unicode escape, expected \\u{...}")
+	}
+
+	hex := ""
+	i := start + 2
+	for i < len(src) && src[i] != "}" {
+		hex += src[i]
+		i++
+	}
+	if i >= len(src) {
+		return "", i, s.error(start-1, i, "unterminated unicode escape")
+	}
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(code)) {
+		return "", i, s.error(start-1, i+1, "invalid unicode escape: \\u{%s}", hex)
+	}
+	return string(rune(code)), i, nil
+}
+
+// TemplatePart is a piece of a backtick string: either literal text or the
+// source of an embedded ${...} expression.
+type TemplatePart struct {
+	Value  string
+	IsExpr bool
+	Span   Span
+}
+
+// SplitTemplate splits a Template token into its parts.
+func SplitTemplate(token Token) ([]TemplatePart, error) {
+	s := newScanner("`"+token.Value+"`", token.Span.Start)
+
+	parts, _, err := s.readTemplate(0)
+	return parts, err
+}
+
+// readTemplate reads a backtick string, which may span several lines, keeps
+// its text as written and splits out embedded ${...} expressions. It returns
+// the index of the closing backtick.
+func (s *scanner) readTemplate(start int) ([]TemplatePart, int, error) {
+	src := s.src
+	parts := make([]TemplatePart, 0)
+	text := ""
+	textStart := start + 1
+
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == "`":
+			if text != "" || len(parts) == 0 {
+				parts = append(parts, TemplatePart{Value: text, Span: s.span(textStart, i)})
+			}
+			return parts, i, nil
+		case src[i] == "\\" && i+2 < len(src) && src[i+1] == "$" && src[i+2] == "{":
+			text += "${"
+			i += 2
+		case src[i] == "$" && i+1 < len(src) && src[i+1] == "{":
+			if text != "" {
+				parts = append(parts, TemplatePart{Value: text, Span: s.span(textStart, i)})
+				text = ""
+			}
+			end, err := s.skipTemplateExpr(i + 2)
+			if err != nil {
+				return nil, end, err
+			}
+			parts = append(parts, TemplatePart{Value: strings.Join(src[i+2:end], ""), IsExpr: true, Span: s.span(i+2, end)})
+			i = end
+			textStart = end + 1
+		default:
+			text += src[i]
+		}
 	}
 
-	return str == " " || str == "\t" || str == "\r"
+	err := s.error(start, len(src), "unterminated string literal")
+	err.Incomplete = true
+	return nil, len(src), err
 }
 
-func Tokenize(sourceCode string) []Token {
+// skipTemplateExpr finds the brace closing an embedded expression that starts
+// at src[start], stepping over strings nested inside it.
+func (s *scanner) skipTemplateExpr(start int) (int, error) {
+	src := s.src
+	depth := 0
+
+	for i := start; i < len(src); i++ {
+		var err error
+		switch src[i] {
+		case "{":
+			depth++
+		case "}":
+			if depth == 0 {
+				return i, nil
+			}
+			depth--
+		case `"`, "'":
+			_, i, err = s.readQuotedString(i)
+		case "`":
+			_, i, err = s.readTemplate(i)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+
+	err := s.error(start-2, len(src), "unterminated template expression")
+	err.Incomplete = true
+	return len(src), err
+}
+
+func Tokenize(sourceCode string) ([]Token, error) {
+	return TokenizeAt(sourceCode, Position{Line: 1, Column: 1})
+}
+
+// TokenizeAt tokenizes source code that starts at the given position of a
+// larger source, such as an expression embedded in a template string.
+func TokenizeAt(sourceCode string, start Position) ([]Token, error) {
 	var tokens []Token
 
-	src := strings.Split(sourceCode, "")
+	s := newScanner(sourceCode, start)
+	src := s.src
 	for i := 0; i < len(src); i++ {
 
 		if src[i] == "(" {
-			tokens = append(tokens, newToken(src[i], OpenParen))
+			tokens = append(tokens, s.newToken(src[i], OpenParen, i))
 		} else if src[i] == ")" {
-			tokens = append(tokens, newToken(src[i], CloseParen))
+			tokens = append(tokens, s.newToken(src[i], CloseParen, i))
 		} else if src[i] == "{" {
-			tokens = append(tokens, newToken(src[i], OpenBrace))
+			tokens = append(tokens, s.newToken(src[i], OpenBrace, i))
 		} else if src[i] == "}" {
-			tokens = append(tokens, newToken(src[i], CloseBrace))
+			tokens = append(tokens, s.newToken(src[i], CloseBrace, i))
 		} else if src[i] == "[" {
-			tokens = append(tokens, newToken(src[i], OpenBracket))
+			tokens = append(tokens, s.newToken(src[i], OpenBracket, i))
 		} else if src[i] == "]" {
-			tokens = append(tokens, newToken(src[i], CloseBracket))
+			tokens = append(tokens, s.newToken(src[i], CloseBracket, i))
+		} else if src[i] == "+" && i+1 < len(src) && src[i+1] == "+" {
+			tokens = append(tokens, s.newToken("++", Increment, i))
+			i++
+		} else if src[i] == "-" && i+1 < len(src) && src[i+1] == "-" {
+			tokens = append(tokens, s.newToken("--", Decrement, i))
+			i++
 		} else if src[i] == "+" || src[i] == "-" || src[i] == "*" || src[i] == "%" {
-			tokens = append(tokens, newToken(src[i], BinaryOperator))
+			if i+1 < len(src) && src[i+1] == "=" {
+				tokens = append(tokens, s.newToken(src[i]+"=", CompoundAssign, i))
+				i++
+			} else {
+				tokens = append(tokens, s.newToken(src[i], BinaryOperator, i))
+			}
 		} else if src[i] == "/" {
 			if i+1 < len(src) && src[i+1] == "/" {
 				i++
 				for i < len(src) && src[i] != "\n" {
 					i++
 				}
+			} else if i+1 < len(src) && src[i+1] == "=" {
+				tokens = append(tokens, s.newToken("/=", CompoundAssign, i))
+				i++
 			} else {
-				tokens = append(tokens, newToken(src[i], BinaryOperator))
+				tokens = append(tokens, s.newToken(src[i], BinaryOperator, i))
 			}
 		} else if src[i] == "=" {
 			if i+1 < len(src) && src[i+1] == "=" {
-				tokens = append(tokens, newToken("==", EqualsEquals))
+				tokens = append(tokens, s.newToken("==", EqualsEquals, i))
+				i++
+			} else if i+1 < len(src) && src[i+1] == ">" {
+				tokens = append(tokens, s.newToken("=>", Arrow, i))
 				i++
 			} else {
-				tokens = append(tokens, newToken(src[i], Equals))
+				tokens = append(tokens, s.newToken(src[i], Equals, i))
 			}
 		} else if src[i] == "!" {
 			if i+1 < len(src) && src[i+1] == "=" {
-				tokens = append(tokens, newToken("!=", NotEquals))
+				tokens = append(tokens, s.newToken("!=", NotEquals, i))
 				i++
 			} else {
-				tokens = append(tokens, newToken(src[i], Not))
+				tokens = append(tokens, s.newToken(src[i], Not, i))
 			}
 
+		} else if src[i] == "&" && i+1 < len(src) && src[i+1] == "&" {
+			tokens = append(tokens, s.newToken("&&", And, i))
+			i++
+		} else if src[i] == "|" && i+1 < len(src) && src[i+1] == "|" {
+			tokens = append(tokens, s.newToken("||", Or, i))
+			i++
 		} else if src[i] == "<" {
 			if i+1 < len(src) && src[i+1] == "=" {
-				tokens = append(tokens, newToken("<=", LessThanOrEquals))
+				tokens = append(tokens, s.newToken("<=", LessThanOrEquals, i))
 				i++
 			} else {
-				tokens = append(tokens, newToken(src[i], LessThan))
+				tokens = append(tokens, s.newToken(src[i], LessThan, i))
 			}
 		} else if src[i] == ">" {
 			if i+1 < len(src) && src[i+1] == "=" {
-				tokens = append(tokens, newToken(">=", GreaterThanOrEquals))
+				tokens = append(tokens, s.newToken(">=", GreaterThanOrEquals, i))
 				i++
 			} else {
-				tokens = append(tokens, newToken(src[i], GreaterThan))
+				tokens = append(tokens, s.newToken(src[i], GreaterThan, i))
 			}
 		} else if src[i] == ":" {
-			tokens = append(tokens, newToken(src[i], Colon))
+			tokens = append(tokens, s.newToken(src[i], Colon, i))
+		} else if src[i] == "?" {
+			tokens = append(tokens, s.newToken(src[i], QuestionMark, i))
 		} else if src[i] == ";" {
-			tokens = append(tokens, newToken(src[i], Semicolon))
+			tokens = append(tokens, s.newToken(src[i], Semicolon, i))
 		} else if src[i] == "," {
-			tokens = append(tokens, newToken(src[i], Coma))
+			tokens = append(tokens, s.newToken(src[i], Coma, i))
+		} else if src[i] == "." && i+2 < len(src) && src[i+1] == "." && src[i+2] == "." {
+			tokens = append(tokens, s.newToken("...", Spread, i))
+			i += 2
 		} else if src[i] == "." {
-			tokens = append(tokens, newToken(src[i], Dot))
-		} else if src[i] == `"` {
-			i++
-			str := ""
-			for i < len(src) && src[i] != `"` {
-				str += src[i]
-				i++
+			tokens = append(tokens, s.newToken(src[i], Dot, i))
+		} else if src[i] == `"` || src[i] == "'" || src[i] == "`" {
+			start := i
+			var str string
+			var err error
+			if src[i] == "`" {
+				var parts []TemplatePart
+				parts, i, err = s.readTemplate(i)
+				if err == nil && (len(parts) > 1 || parts[0].IsExpr) {
+					tokens = append(tokens, Token{Value: strings.Join(src[start+1:i], ""), TokenType: Template, Span: s.span(start, i+1)})
+					continue
+				} else if err == nil {
+					str = parts[0].Value
+				}
+			} else {
+				str, i, err = s.readQuotedString(i)
+			}
+			if err != nil {
+				return nil, err
 			}
 
-			tokens = append(tokens, newToken(str, String))
+			tokens = append(tokens, Token{Value: str, TokenType: String, Span: s.span(start, i+1)})
 		} else {
 			if isInt(src[i]) {
+				start := i
 				var num string
 				for i < len(src) && isInt(src[i]) {
 					num += src[i]
 					i++
 				}
-				tokens = append(tokens, newToken(num, Number))
+				// Fraction, only when a digit follows the dot.
+				if i+1 < len(src) && src[i] == "." && isInt(src[i+1]) {
+					num += src[i]
+					i++
+					for i < len(src) && isInt(src[i]) {
+						num += src[i]
+						i++
+					}
+				}
+				// Exponent such as e9, e+9 or e-9.
+				if i < len(src) && (src[i] == "e" || src[i] == "E") {
+					digits := i + 1
+					if digits < len(src) && (src[digits] == "+" || src[digits] == "-") {
+						digits++
+					}
+					if digits < len(src) && isInt(src[digits]) {
+						for i < digits {
+							num += src[i]
+							i++
+						}
+						for i < len(src) && isInt(src[i]) {
+							num += src[i]
+							i++
+						}
+					}
+				}
+				tokens = append(tokens, s.newToken(num, Number, start))
 				i--
 				continue
 			} else if isAlpha(src[i]) {
+				start := i
 				indet := src[i]
 				i++
 				for i < len(src) && isAlphaNumeric(src[i]) {
@@ -185,19 +495,18 @@ func Tokenize(sourceCode string) []Token {
 				i--
 				elem, ok := KEYWORDS[indet]
 				if ok {
-					tokens = append(tokens, newToken(indet, elem))
+					tokens = append(tokens, s.newToken(indet, elem, start))
 				} else {
-					tokens = append(tokens, newToken(indet, Identifier))
+					tokens = append(tokens, s.newToken(indet, Identifier, start))
 				}
 				continue
 			} else if isSkippable(src[i]) {
 				continue
 			} else {
-				fmt.Printf("syntaxError: unreconized character found in source: %v\n", src[i])
-				os.Exit(1)
+				return nil, s.error(i, i+1, "unrecognized character found in source: %v", src[i])
 			}
 		}
 	}
-	tokens = append(tokens, Token{Value: "EOF", TokenType: EOF})
-	return tokens
+	tokens = append(tokens, Token{Value: "EOF", TokenType: EOF, Span: s.span(len(src), len(src))})
+	return tokens, nil
 }
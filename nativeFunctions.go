@@ -2,15 +2,15 @@ package main
 
 import "fmt"
 
-func nativePrint(args []RuntimeVal, env *Env) RuntimeVal {
+func nativePrint(args []RuntimeVal, env *Env) (RuntimeVal, error) {
 
 	for _, arg := range args {
 		fmt.Printf("%v ", arg)
 	}
 
-	return NullVal{}
+	return NullVal{}, nil
 }
-func nativePrintln(args []RuntimeVal, env *Env) RuntimeVal {
+func nativePrintln(args []RuntimeVal, env *Env) (RuntimeVal, error) {
 
 	for _, arg := range args {
 		fmt.Printf("%v ", arg)
@@ -18,5 +18,15 @@ func nativePrintln(args []RuntimeVal, env *Env) RuntimeVal {
 
 	fmt.Print("\n")
 
-	return NullVal{}
+	return NullVal{}, nil
+}
+
+// nativeError creates an error value to throw: Error("message").
+func nativeError(args []RuntimeVal, env *Env) (RuntimeVal, error) {
+	message := ""
+	if len(args) > 0 {
+		message = toText(args[0])
+	}
+
+	return ErrorVal{kind: GenericError, message: message}, nil
 }
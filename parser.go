@@ -1,18 +1,24 @@
 package main
 
 import (
-	"fmt"
-	"main/lexer"
-	"os"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 // Order Of Presidence
+// ArrowFunction
 // AssigmentExpr
 // ObjectExpr
+// ConditionalExpr
+// LogicalOrExpr
+// LogicalAndExpr
 // BooleanExpr
 // AdditiveExpr
 // MultiplicitaveExpr
+// UnaryExpr
+// UpdateExpr
 // CallExpr
 // MemberExpr
 // PrimaryExpr
@@ -20,6 +26,17 @@ import (
 type Parser struct {
 	tokens            []lexer.Token
 	currentTokenIndex uint
+	// loopDepth and functionDepth tell whether break, continue and return
+	// statements have something to leave.
+	loopDepth     int
+	functionDepth int
+	// blockDepth is how many blocks enclose the current token, so recovery
+	// knows whether a close brace ends one.
+	blockDepth int
+	// errors collects the syntax errors the parser recovered from.
+	errors ErrorList
+	// lastToken is the most recently consumed token, where the span of the node being parsed ends.
+	lastToken lexer.Token
 }
 
 func (p *Parser) at() lexer.Token {
@@ -27,9 +44,31 @@ func (p *Parser) at() lexer.Token {
 }
 func (p *Parser) eat() lexer.Token {
 	token := p.at()
-	p.currentTokenIndex++
+	if token.TokenType != lexer.EOF {
+		p.currentTokenIndex++
+	}
+	p.lastToken = token
 	return token
 }
+
+// spanFrom returns the span from start to the end of the last consumed token.
+func (p *Parser) spanFrom(start lexer.Span) lexer.Span {
+	return lexer.Span{Start: start.Start, End: p.lastToken.Span.End}
+}
+func joinSpans(first, last lexer.Span) lexer.Span {
+	return lexer.Span{Start: first.Start, End: last.End}
+}
+
+// peek returns the token offset positions after the current one.
+func (p *Parser) peek(offset uint) lexer.Token {
+	return p.tokens[min(p.currentTokenIndex+offset, uint(len(p.tokens)-1))]
+}
+
+// isOperator reports whether the current token is one of the given binary
+// operators. Checking the token type keeps strings like "-" from matching.
+func (p *Parser) isOperator(operators ...string) bool {
+	return p.isTokenType(lexer.BinaryOperator) && slices.Contains(operators, p.at().Value)
+}
 func (p *Parser) isTokenType(types ...lexer.TokenType) bool {
 	currentToken := p.at()
 
@@ -40,245 +79,953 @@ func (p *Parser) isTokenType(types ...lexer.TokenType) bool {
 	}
 	return false
 }
-func (p *Parser) expect(tType lexer.TokenType) lexer.Token {
-	token := p.eat()
+
+// expect eats the current token if it has the given type. A mismatched token
+// is left in place so recovery can start from it.
+func (p *Parser) expect(tType lexer.TokenType) (lexer.Token, error) {
+	token := p.at()
 	if token.TokenType != tType {
-		fmt.Printf("Parser Error:\n Expecting: %v found: %v. Line:%v \n", tType, token.TokenType, token.Line)
-		os.Exit(1)
+		return token, newSyntaxError(token.Span, "Expecting: %v found: %v", tType, token.TokenType)
 	}
-	return token
+	return p.eat(), nil
 }
-func (p *Parser) parseStmt() Stmt {
+func (p *Parser) parseStmt() (Stmt, error) {
 	if p.isTokenType(lexer.Let, lexer.Const) {
 		return p.parseVarDeclaration()
-	} else if p.isTokenType(lexer.Fn) {
+	} else if p.isTokenType(lexer.Fn) && p.peek(1).TokenType == lexer.Identifier {
 		return p.parseFnDecralation()
 	} else if p.isTokenType(lexer.If) {
 		return p.parseIfStmt()
+	} else if p.isTokenType(lexer.Match) {
+		return p.parseMatchStmt()
 	} else if p.isTokenType(lexer.While) {
 		return p.parseWhileStmt()
+	} else if p.isTokenType(lexer.For) {
+		return p.parseForStmt()
+	} else if p.isTokenType(lexer.Return) {
+		return p.parseReturnStmt()
+	} else if p.isTokenType(lexer.Break, lexer.Continue) {
+		return p.parseLoopControlStmt()
+	} else if p.isTokenType(lexer.Throw) {
+		return p.parseThrowStmt()
+	} else if p.isTokenType(lexer.Try) {
+		return p.parseTryStmt()
 	}
 
-	return p.parseExpr()
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isTokenType(lexer.Semicolon) {
+		p.eat()
+	}
+	return expr, nil
 }
-func (p *Parser) parseVarDeclaration() VarDeclaration {
-	isConstant := p.eat().TokenType == lexer.Const
-	identifier := p.expect(lexer.Identifier).Value
 
-	if p.isTokenType(lexer.Semicolon) {
+// parseStmtRecovering parses a statement. On a syntax error it records the
+// error and skips to the start of the next statement, so one mistake does not
+// hide the ones after it.
+func (p *Parser) parseStmtRecovering() (Stmt, bool) {
+	start := p.currentTokenIndex
+	stmt, err := p.parseStmt()
+	if err == nil {
+		return stmt, true
+	}
+
+	p.errors.add(err)
+	if p.currentTokenIndex == start {
+		p.eat()
+	}
+	p.synchronize()
+	return nil, false
+}
+
+// synchronize skips tokens up to a statement boundary: past a semicolon or a
+// skipped block, or before a keyword that starts a statement or the brace
+// closing the enclosing block. Stray braces at the top level are skipped.
+func (p *Parser) synchronize() {
+	depth := 0
+
+	for !p.isTokenType(lexer.EOF) {
+		switch p.at().TokenType {
+		case lexer.OpenBrace:
+			depth++
+		case lexer.CloseBrace:
+			if depth == 0 {
+				// At the top level the brace closes no block and is skipped.
+				if p.blockDepth > 0 {
+					return
+				}
+				break
+			}
+			depth--
+			if depth == 0 {
+				p.eat()
+				if !p.isTokenType(lexer.Else, lexer.Catch, lexer.Finally) {
+					return
+				}
+				continue
+			}
+		case lexer.Semicolon:
+			if depth == 0 {
+				p.eat()
+				return
+			}
+		case lexer.Let, lexer.Const, lexer.Fn, lexer.If, lexer.Match, lexer.While, lexer.For, lexer.Return, lexer.Break, lexer.Continue, lexer.Throw, lexer.Try:
+			if depth == 0 {
+				return
+			}
+		}
 		p.eat()
+	}
+}
+func (p *Parser) parseVarDeclaration() (Stmt, error) {
+	keyword := p.eat()
+	isConstant := keyword.TokenType == lexer.Const
+	identifier, err := p.expect(lexer.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isTokenType(lexer.Semicolon) {
+		semicolon := p.eat()
 		if isConstant {
-			println("Cannot initialize constant variable without value")
-			os.Exit(1)
+			return nil, newSyntaxError(semicolon.Span, "Cannot initialize constant variable without value")
 		}
-		return VarDeclaration{constant: false, identifier: identifier}
+		return VarDeclaration{Node: Node{p.spanFrom(keyword.Span)}, constant: false, identifier: identifier.Value}, nil
+	}
+	if _, err := p.expect(lexer.Equals); err != nil {
+		return nil, err
+	}
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	// Anonymous functions take the name of the variable they are declared with.
+	if fn, ok := value.(FunctionExpr); ok && fn.name == "" {
+		fn.name = identifier.Value
+		value = fn
 	}
-	p.expect(lexer.Equals)
 	decralation := VarDeclaration{
-		constant: isConstant, identifier: identifier, value: p.parseExpr(),
+		Node:     Node{keyword.Span},
+		constant: isConstant, identifier: identifier.Value, value: value,
 	}
-	nextToken := p.eat()
-	if nextToken.TokenType != lexer.Semicolon {
-		fmt.Printf("Missing semicolon at the end of variable declaration: %v Line:%v\n", decralation.identifier, nextToken.Line)
-		os.Exit(1)
+	if !p.isTokenType(lexer.Semicolon) {
+		return nil, newSyntaxError(p.lastToken.Span, "Missing semicolon at the end of variable declaration: %v", decralation.identifier)
 	}
+	p.eat()
+	decralation.span = p.spanFrom(keyword.Span)
 
-	return decralation
+	return decralation, nil
 
 }
-func (p *Parser) parseFnDecralation() FunctionDeclaration {
-	p.eat()
-	name := p.expect(lexer.Identifier).Value
-	args := p.parseArgs()
-	params := make([]string, len(args))
+func (p *Parser) parseFnDecralation() (Stmt, error) {
+	keyword := p.eat()
+	name, err := p.expect(lexer.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseFunctionBody(p.parseBlock)
+	if err != nil {
+		return nil, err
+	}
+	return FunctionDeclaration{Node: Node{p.spanFrom(keyword.Span)}, name: name.Value, parameters: params, body: body}, nil
+}
+func (p *Parser) parseFunctionExpr() (Expr, error) {
+	keyword := p.eat()
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseFunctionBody(p.parseBlock)
+	if err != nil {
+		return nil, err
+	}
+	return FunctionExpr{Node: Node{p.spanFrom(keyword.Span)}, parameters: params, body: body}, nil
+}
 
-	for i, arg := range args {
-		v, ok := arg.(Identifier)
-		if !ok {
-			fmt.Println("Expect strings as parametrs inside function declaration")
+// parseArrowFunction parses `x => expr` and `(a, b) => { ... }`. An
+// expression body is the value the function returns.
+func (p *Parser) parseArrowFunction() (Expr, error) {
+	start := p.at()
+	var params []Parameter
+	if p.isTokenType(lexer.Identifier) {
+		param := p.eat()
+		params = []Parameter{{Node: Node{param.Span}, name: param.Value}}
+	} else {
+		var err error
+		if params, err = p.parseParams(); err != nil {
+			return nil, err
 		}
-		params[i] = v.symbol
 	}
-	p.expect(lexer.OpenBrace)
+	if _, err := p.expect(lexer.Arrow); err != nil {
+		return nil, err
+	}
 
-	body := make([]Stmt, 0)
-	for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
-		body = append(body, p.parseStmt())
+	body, err := p.parseFunctionBody(func() ([]Stmt, error) {
+		if p.isTokenType(lexer.OpenBrace) {
+			return p.parseBlock()
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return []Stmt{expr}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	p.expect(lexer.CloseBrace)
-	return FunctionDeclaration{name: name, parameters: params, body: body}
+	return FunctionExpr{Node: Node{p.spanFrom(start.Span)}, parameters: params, body: body, arrow: true}, nil
 }
-func (p *Parser) parseIfStmt() IfStmt {
-	p.eat()
 
-	p.expect(lexer.OpenParen)
-	condition := p.parseExpr()
-	p.expect(lexer.CloseParen)
+// isArrowFunction looks ahead for `x =>` or a parenthesized list followed by `=>`.
+func (p *Parser) isArrowFunction() bool {
+	if p.isTokenType(lexer.Identifier) {
+		return p.peek(1).TokenType == lexer.Arrow
+	}
+	if !p.isTokenType(lexer.OpenParen) {
+		return false
+	}
 
-	p.expect(lexer.OpenBrace)
-	body := make([]Stmt, 0)
-	for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
-		body = append(body, p.parseStmt())
+	depth := 0
+	for offset := uint(0); ; offset++ {
+		switch p.peek(offset).TokenType {
+		case lexer.OpenParen:
+			depth++
+		case lexer.CloseParen:
+			depth--
+			if depth == 0 {
+				return p.peek(offset+1).TokenType == lexer.Arrow
+			}
+		case lexer.EOF:
+			return false
+		}
+	}
+}
+
+// parseParams parses a parenthesized list of parameters. They are parsed as
+// call arguments first: `b = 2` is an assignment and `...rest` a spread.
+func (p *Parser) parseParams() ([]Parameter, error) {
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	params := make([]Parameter, len(args))
+	declared := make(map[string]bool)
+
+	for i, arg := range args {
+		param := Parameter{Node: Node{arg.getSpan()}}
+		switch arg := arg.(type) {
+		case Identifier:
+			param.name = arg.symbol
+		case AssigmentExpr:
+			ident, ok := arg.assigne.(Identifier)
+			if !ok || arg.operator != "=" {
+				return nil, newSyntaxError(arg.span, "Expect parameter name before default value")
+			}
+			param.name = ident.symbol
+			param.defaultValue = arg.value
+		case SpreadExpr:
+			ident, ok := arg.argument.(Identifier)
+			if !ok {
+				return nil, newSyntaxError(arg.argument.getSpan(), "Expect identifier after ... in rest parameter")
+			}
+			if i != len(args)-1 {
+				return nil, newSyntaxError(arg.span, "Rest parameter must be the last parameter")
+			}
+			param.name = ident.symbol
+			param.rest = true
+		default:
+			return nil, newSyntaxError(arg.getSpan(), "Expect identifiers as parameters inside function declaration")
+		}
+
+		if param.name == "this" {
+			return nil, newSyntaxError(param.span, "Cannot use 'this' as a parameter name")
+		}
+		if declared[param.name] {
+			return nil, newSyntaxError(param.span, "Duplicate parameter name: %s", param.name)
+		}
+		declared[param.name] = true
+		params[i] = param
+	}
+	return params, nil
+}
+
+// parseFunctionBody runs parseBody in the context of a new function, where
+// return is allowed and break and continue cannot reach enclosing loops.
+func (p *Parser) parseFunctionBody(parseBody func() ([]Stmt, error)) ([]Stmt, error) {
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
+	p.functionDepth++
+	body, err := parseBody()
+	p.functionDepth--
+	p.loopDepth = outerLoopDepth
+	return body, err
+}
+func (p *Parser) parseIfStmt() (Stmt, error) {
+	keyword := p.eat()
+
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
 	}
-	p.expect(lexer.CloseBrace)
 
 	alternative := make([]Stmt, 0)
 	if p.isTokenType(lexer.Else) {
 		p.eat()
-		p.expect(lexer.OpenBrace)
-		for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
-			alternative = append(alternative, p.parseStmt())
+		if p.isTokenType(lexer.If) {
+			elseIf, err := p.parseIfStmt()
+			if err != nil {
+				return nil, err
+			}
+			alternative = []Stmt{elseIf}
+		} else if alternative, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	return IfStmt{Node{p.spanFrom(keyword.Span)}, condition, body, alternative}, nil
+}
+
+// parseMatchStmt parses
+//
+//	match (value) {
+//	    1 => expr
+//	    2, 3 => { ... }
+//	    else => expr
+//	}
+func (p *Parser) parseMatchStmt() (Stmt, error) {
+	keyword := p.eat()
+
+	value, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(lexer.OpenBrace); err != nil {
+		return nil, err
+	}
+
+	stmt := MatchStmt{value: value}
+	for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
+		start := p.at()
+		if p.isTokenType(lexer.Else) {
+			p.eat()
+			if stmt.fallback != nil {
+				return nil, newSyntaxError(start.Span, "Match statement can only have one else arm")
+			}
+			body, err := p.parseMatchArmBody()
+			if err != nil {
+				return nil, err
+			}
+			stmt.fallback = body
+			continue
+		}
+
+		arm := MatchArm{}
+		for {
+			// Arm values are parsed below arrow functions, so `true =>` is not
+			// mistaken for a function with a parameter named true.
+			armValue, err := p.parseConditionalExpr()
+			if err != nil {
+				return nil, err
+			}
+			arm.values = append(arm.values, armValue)
+			if !p.isTokenType(lexer.Coma) {
+				break
+			}
+			p.eat()
+		}
+		body, err := p.parseMatchArmBody()
+		if err != nil {
+			return nil, err
+		}
+		arm.body = body
+		arm.span = p.spanFrom(start.Span)
+		stmt.arms = append(stmt.arms, arm)
+	}
+	if _, err := p.expect(lexer.CloseBrace); err != nil {
+		return nil, err
+	}
+
+	stmt.span = p.spanFrom(keyword.Span)
+	return stmt, nil
+}
+
+// parseMatchArmBody parses the `=> body` part of a match arm, where the body is
+// a block or a single statement, optionally followed by a comma.
+func (p *Parser) parseMatchArmBody() ([]Stmt, error) {
+	if _, err := p.expect(lexer.Arrow); err != nil {
+		return nil, err
+	}
+	if p.isTokenType(lexer.OpenBrace) {
+		return p.parseBlock()
+	}
+
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	if p.isTokenType(lexer.Coma) {
+		p.eat()
+	}
+	return []Stmt{body}, nil
+}
+func (p *Parser) parseWhileStmt() (Stmt, error) {
+	keyword := p.eat()
+
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return WhileStmt{Node{p.spanFrom(keyword.Span)}, condition, body}, nil
+}
+
+// parseForStmt parses `for (init; condition; update) { }` and `for (x in iterable) { }`.
+func (p *Parser) parseForStmt() (Stmt, error) {
+	keyword := p.eat()
+	if _, err := p.expect(lexer.OpenParen); err != nil {
+		return nil, err
+	}
+
+	if p.isForIn() {
+		return p.parseForInStmt(keyword)
+	}
+
+	stmt := ForStmt{}
+	if p.isTokenType(lexer.Let, lexer.Const) {
+		init, err := p.parseVarDeclaration()
+		if err != nil {
+			return nil, err
+		}
+		stmt.init = init
+	} else {
+		if !p.isTokenType(lexer.Semicolon) {
+			init, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.init = init
+		}
+		if _, err := p.expect(lexer.Semicolon); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.isTokenType(lexer.Semicolon) {
+		condition, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
-		p.expect(lexer.CloseBrace)
+		stmt.condition = condition
+	}
+	if _, err := p.expect(lexer.Semicolon); err != nil {
+		return nil, err
 	}
 
-	return IfStmt{condition, body, alternative}
+	if !p.isTokenType(lexer.CloseParen) {
+		update, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.update = update
+	}
+	if _, err := p.expect(lexer.CloseParen); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	stmt.body = body
+	stmt.span = p.spanFrom(keyword.Span)
+	return stmt, nil
 }
-func (p *Parser) parseWhileStmt() WhileStmt {
+func (p *Parser) parseForInStmt(keyword lexer.Token) (Stmt, error) {
+	stmt := ForInStmt{}
+	if p.isTokenType(lexer.Let, lexer.Const) {
+		stmt.constant = p.eat().TokenType == lexer.Const
+	}
+	variable := p.eat()
+	stmt.variable = variable.Value
+	stmt.declaredAt = variable.Span
 	p.eat()
 
-	p.expect(lexer.OpenParen)
-	condition := p.parseExpr()
-	p.expect(lexer.CloseParen)
+	iterable, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	stmt.iterable = iterable
+	if _, err := p.expect(lexer.CloseParen); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	stmt.body = body
+	stmt.span = p.spanFrom(keyword.Span)
+	return stmt, nil
+}
+
+// isForIn looks ahead for `x in` or `let x in` after the opening paren of a for loop.
+func (p *Parser) isForIn() bool {
+	offset := uint(0)
+	if p.isTokenType(lexer.Let, lexer.Const) {
+		offset++
+	}
+	return p.peek(offset).TokenType == lexer.Identifier && p.peek(offset+1).TokenType == lexer.In
+}
+func (p *Parser) parseLoopBody() ([]Stmt, error) {
+	p.loopDepth++
+	body, err := p.parseBlock()
+	p.loopDepth--
+	return body, err
+}
+func (p *Parser) parseThrowStmt() (Stmt, error) {
+	keyword := p.eat()
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isTokenType(lexer.Semicolon) {
+		p.eat()
+	}
+	return ThrowStmt{Node{p.spanFrom(keyword.Span)}, value}, nil
+}
+
+// parseTryStmt parses `try { } catch (e) { } finally { }`, where the catch
+// parameter is optional and at least one of catch and finally is required.
+func (p *Parser) parseTryStmt() (Stmt, error) {
+	keyword := p.eat()
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	stmt := TryStmt{body: body}
+
+	if p.isTokenType(lexer.Catch) {
+		p.eat()
+		if p.isTokenType(lexer.OpenParen) {
+			p.eat()
+			param, err := p.expect(lexer.Identifier)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(lexer.CloseParen); err != nil {
+				return nil, err
+			}
+			stmt.catchParam = param.Value
+			stmt.catchParamSpan = param.Span
+		}
+		if stmt.catchBody, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isTokenType(lexer.Finally) {
+		p.eat()
+		if stmt.finally, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.catchBody == nil && stmt.finally == nil {
+		return nil, newSyntaxError(p.at().Span, "Expected catch or finally after try block")
+	}
+
+	stmt.span = p.spanFrom(keyword.Span)
+	return stmt, nil
+}
+func (p *Parser) parseReturnStmt() (Stmt, error) {
+	keyword := p.eat()
+	if p.functionDepth == 0 {
+		return nil, newSyntaxError(keyword.Span, "Cannot use return outside of a function")
+	}
+
+	stmt := ReturnStmt{}
+	if !p.isTokenType(lexer.Semicolon, lexer.CloseBrace, lexer.EOF) {
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.value = value
+	}
+	if p.isTokenType(lexer.Semicolon) {
+		p.eat()
+	}
+	stmt.span = p.spanFrom(keyword.Span)
+
+	return stmt, nil
+}
+func (p *Parser) parseLoopControlStmt() (Stmt, error) {
+	keyword := p.eat()
+	if p.loopDepth == 0 {
+		return nil, newSyntaxError(keyword.Span, "Cannot use %s outside of a loop", keyword.Value)
+	}
+	if p.isTokenType(lexer.Semicolon) {
+		p.eat()
+	}
+
+	if keyword.TokenType == lexer.Break {
+		return BreakStmt{Node{p.spanFrom(keyword.Span)}}, nil
+	}
+	return ContinueStmt{Node{p.spanFrom(keyword.Span)}}, nil
+}
+
+// parseCondition parses a parenthesized expression such as the condition of if and while.
+func (p *Parser) parseCondition() (Expr, error) {
+	if _, err := p.expect(lexer.OpenParen); err != nil {
+		return nil, err
+	}
+	condition, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(lexer.CloseParen); err != nil {
+		return nil, err
+	}
+	return condition, nil
+}
 
-	p.expect(lexer.OpenBrace)
+// parseBlock parses statements enclosed in braces.
+func (p *Parser) parseBlock() ([]Stmt, error) {
+	if _, err := p.expect(lexer.OpenBrace); err != nil {
+		return nil, err
+	}
 	body := make([]Stmt, 0)
+	p.blockDepth++
 	for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
-		body = append(body, p.parseStmt())
+		if stmt, ok := p.parseStmtRecovering(); ok {
+			body = append(body, stmt)
+		}
 	}
-	p.expect(lexer.CloseBrace)
-
-	return WhileStmt{condition, body}
+	p.blockDepth--
+	if _, err := p.expect(lexer.CloseBrace); err != nil {
+		return nil, err
+	}
+	return body, nil
 }
-func (p *Parser) parseExpr() Expr {
+func (p *Parser) parseExpr() (Expr, error) {
 
 	return p.parseAssignmentExpr()
 }
-func (p *Parser) parseAssignmentExpr() Expr {
-	left := p.parseObjectExpr()
+func (p *Parser) parseAssignmentExpr() (Expr, error) {
+	if p.isArrowFunction() {
+		return p.parseArrowFunction()
+	}
+	left, err := p.parseObjectExpr()
+	if err != nil {
+		return nil, err
+	}
 
-	if p.isTokenType(lexer.Equals) {
-		p.eat()
-		value := p.parseAssignmentExpr()
-		return AssigmentExpr{value: value, assigne: left}
+	if p.isTokenType(lexer.Equals) || p.isTokenType(lexer.CompoundAssign) {
+		operator := p.eat().Value
+		switch left.(type) {
+		case Identifier, MemberExpr:
+		default:
+			return nil, newSyntaxError(left.getSpan(), "Invalid left-hand side in assignment, expected a variable, property or array element")
+		}
+		value, err := p.parseAssignmentExpr()
+		if err != nil {
+			return nil, err
+		}
+		return AssigmentExpr{Node: Node{joinSpans(left.getSpan(), value.getSpan())}, value: value, assigne: left, operator: operator}, nil
 	}
-	return left
+	return left, nil
 }
-func (p *Parser) parseObjectExpr() Expr {
+func (p *Parser) parseObjectExpr() (Expr, error) {
 	if !p.isTokenType(lexer.OpenBrace) {
-		return p.parseBooleanExpr()
+		return p.parseConditionalExpr()
 	}
-	p.eat()
+	openBrace := p.eat()
 	properties := make([]Property, 0)
 
 	for !p.isTokenType(lexer.EOF, lexer.CloseBrace) {
-		key := p.expect(lexer.Identifier).Value
+		key, err := p.expect(lexer.Identifier)
+		if err != nil {
+			return nil, err
+		}
 
 		if p.isTokenType(lexer.Coma) {
 			p.eat()
-			properties = append(properties, Property{key: key, value: nil})
+			properties = append(properties, Property{Node: Node{key.Span}, key: key.Value, value: nil})
 			continue
 		} else if p.isTokenType(lexer.CloseBrace) {
-			properties = append(properties, Property{key: key, value: nil})
+			properties = append(properties, Property{Node: Node{key.Span}, key: key.Value, value: nil})
 			continue
 		}
 
-		p.expect(lexer.Colon)
-		value := p.parseExpr()
+		if _, err := p.expect(lexer.Colon); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
 
-		properties = append(properties, Property{key, value})
+		properties = append(properties, Property{Node{joinSpans(key.Span, value.getSpan())}, key.Value, value})
 
 		if !p.isTokenType(lexer.CloseBrace) {
-			p.expect(lexer.Coma)
+			if _, err := p.expect(lexer.Coma); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	p.expect(lexer.CloseBrace)
+	if _, err := p.expect(lexer.CloseBrace); err != nil {
+		return nil, err
+	}
 
-	return ObjectLiteral{properties}
+	return ObjectLiteral{Node{p.spanFrom(openBrace.Span)}, properties}, nil
 }
-func (p *Parser) parseBooleanExpr() Expr {
-	left := p.parseUnaryExpr()
+func (p *Parser) parseConditionalExpr() (Expr, error) {
+	condition, err := p.parseLogicalOrExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isTokenType(lexer.QuestionMark) {
+		return condition, nil
+	}
+	p.eat()
+
+	consequent, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(lexer.Colon); err != nil {
+		return nil, err
+	}
+	alternative, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return ConditionalExpr{Node{joinSpans(condition.getSpan(), alternative.getSpan())}, condition, consequent, alternative}, nil
+}
+func (p *Parser) parseLogicalOrExpr() (Expr, error) {
+	left, err := p.parseLogicalAndExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isTokenType(lexer.Or) {
+		operator := p.eat().Value
+		right, err := p.parseLogicalAndExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpr{Node{joinSpans(left.getSpan(), right.getSpan())}, left, right, operator}
+	}
+	return left, nil
+}
+func (p *Parser) parseLogicalAndExpr() (Expr, error) {
+	left, err := p.parseBooleanExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isTokenType(lexer.And) {
+		operator := p.eat().Value
+		right, err := p.parseBooleanExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpr{Node{joinSpans(left.getSpan(), right.getSpan())}, left, right, operator}
+	}
+	return left, nil
+}
+func (p *Parser) parseBooleanExpr() (Expr, error) {
+	left, err := p.parseAdditiveExpr()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.isTokenType(lexer.EqualsEquals, lexer.NotEquals, lexer.LessThan, lexer.GreaterThan, lexer.LessThanOrEquals, lexer.GreaterThanOrEquals) {
 		operator := p.eat().Value
-		right := p.parseUnaryExpr()
-		left = BooleanExpr{left, right, operator}
+		right, err := p.parseAdditiveExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = BooleanExpr{Node{joinSpans(left.getSpan(), right.getSpan())}, left, right, operator}
 	}
-	return left
+	return left, nil
 }
-func (p *Parser) parseUnaryExpr() Expr {
+func (p *Parser) parseUnaryExpr() (Expr, error) {
+	if !p.isTokenType(lexer.Not) && !p.isOperator("-", "+") {
+		return p.parseUpdateExpr()
+	}
 
-	if p.isTokenType(lexer.Not) {
-		p.eat()
-		return UnaryExpression{operator: "!", operand: p.parseAdditiveExpr()}
+	operator := p.eat()
+	operand, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
 	}
+	span := joinSpans(operator.Span, operand.getSpan())
 
-	return p.parseAdditiveExpr()
+	// Negative numbers are folded into the literal.
+	if literal, ok := operand.(NumericLiteral); ok && operator.Value == "-" {
+		return NumericLiteral{Node: Node{span}, value: -literal.value, floatValue: -literal.floatValue, isFloat: literal.isFloat}, nil
+	}
+	return UnaryExpression{Node: Node{span}, operator: operator.Value, operand: operand}, nil
 }
-func (p *Parser) parseAdditiveExpr() Expr {
-	left := p.parseMultiplicitaveExpr()
+func (p *Parser) parseAdditiveExpr() (Expr, error) {
+	left, err := p.parseMultiplicitaveExpr()
+	if err != nil {
+		return nil, err
+	}
 
-	for p.at().Value == "+" || p.at().Value == "-" {
+	for p.isOperator("+", "-") {
 		operator := p.eat().Value
-		right := p.parseMultiplicitaveExpr()
-		left = BinaryExpr{left, right, operator}
+		right, err := p.parseMultiplicitaveExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Node{joinSpans(left.getSpan(), right.getSpan())}, left, right, operator}
 	}
 
-	return left
+	return left, nil
 }
-func (p *Parser) parseMultiplicitaveExpr() Expr {
-	left := p.parseCallMemberExpr()
+func (p *Parser) parseMultiplicitaveExpr() (Expr, error) {
+	left, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
 
-	for p.at().Value == "/" || p.at().Value == "*" || p.at().Value == "%" {
+	for p.isOperator("/", "*", "%") {
 		operator := p.eat().Value
-		right := p.parseCallMemberExpr()
-		left = BinaryExpr{left, right, operator}
+		right, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Node{joinSpans(left.getSpan(), right.getSpan())}, left, right, operator}
 
 	}
-	return left
+	return left, nil
 }
-func (p *Parser) parseCallMemberExpr() Expr {
-	member := p.parseMemberExpr()
+func (p *Parser) parseUpdateExpr() (Expr, error) {
+	if p.isTokenType(lexer.Increment) || p.isTokenType(lexer.Decrement) {
+		operator := p.eat()
+		target, err := p.parseCallMemberExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkUpdateTarget(target, operator.Value); err != nil {
+			return nil, err
+		}
+		return UpdateExpr{Node: Node{joinSpans(operator.Span, target.getSpan())}, target: target, operator: operator.Value, prefix: true}, nil
+	}
+
+	target, err := p.parseCallMemberExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isTokenType(lexer.Increment) || p.isTokenType(lexer.Decrement) {
+		operator := p.eat()
+		if err := checkUpdateTarget(target, operator.Value); err != nil {
+			return nil, err
+		}
+		return UpdateExpr{Node: Node{joinSpans(target.getSpan(), operator.Span)}, target: target, operator: operator.Value}, nil
+	}
+	return target, nil
+}
+func checkUpdateTarget(target Expr, operator string) error {
+	switch target.(type) {
+	case Identifier, MemberExpr:
+		return nil
+	default:
+		return newSyntaxError(target.getSpan(), "Invalid operand for %s, expected a variable, property or array element", operator)
+	}
+}
+func (p *Parser) parseCallMemberExpr() (Expr, error) {
+	member, err := p.parseMemberExpr()
+	if err != nil {
+		return nil, err
+	}
 
 	if p.isTokenType(lexer.OpenParen) {
 		return p.parseCallExpr(member)
 	}
-	return member
+	return member, nil
 }
-func (p *Parser) parseCallExpr(caller Expr) Expr {
-	var callExpr Expr = CallExpr{caller: caller, args: p.parseArgs()}
+func (p *Parser) parseCallExpr(caller Expr) (Expr, error) {
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	var callExpr Expr = CallExpr{Node: Node{p.spanFrom(caller.getSpan())}, caller: caller, args: args}
 
 	if p.isTokenType(lexer.OpenParen) {
-		callExpr = p.parseCallExpr(callExpr)
+		return p.parseCallExpr(callExpr)
 	}
-	return callExpr
+	return callExpr, nil
 }
-func (p *Parser) parseArgs() []Expr {
-	p.expect(lexer.OpenParen)
+func (p *Parser) parseArgs() ([]Expr, error) {
+	if _, err := p.expect(lexer.OpenParen); err != nil {
+		return nil, err
+	}
 	args := make([]Expr, 0)
 
 	if p.isTokenType(lexer.CloseParen) {
 		p.eat()
-		return args
-	} else {
-		args = p.parseArgsList()
-		p.expect(lexer.CloseParen)
+		return args, nil
+	}
+	args, err := p.parseArgsList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(lexer.CloseParen); err != nil {
+		return nil, err
 	}
-	return args
+	return args, nil
 }
-func (p *Parser) parseArgsList() []Expr {
-	args := []Expr{p.parseAssignmentExpr()}
+func (p *Parser) parseArgsList() ([]Expr, error) {
+	first, err := p.parseListElement()
+	if err != nil {
+		return nil, err
+	}
+	args := []Expr{first}
 
 	for p.isTokenType(lexer.Coma) && !p.isTokenType(lexer.EOF) {
 		p.eat()
-		args = append(args, p.parseAssignmentExpr())
+		arg, err := p.parseListElement()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
 	}
 
-	return args
+	return args, nil
+}
+
+// parseListElement parses an argument or array element, which may be spread with `...`.
+func (p *Parser) parseListElement() (Expr, error) {
+	if !p.isTokenType(lexer.Spread) {
+		return p.parseAssignmentExpr()
+	}
+	spread := p.eat()
+	argument, err := p.parseAssignmentExpr()
+	if err != nil {
+		return nil, err
+	}
+	return SpreadExpr{Node{joinSpans(spread.Span, argument.getSpan())}, argument}, nil
 }
-func (p *Parser) parseMemberExpr() Expr {
-	object := p.parsePrimaryExpr()
+func (p *Parser) parseMemberExpr() (Expr, error) {
+	object, err := p.parsePrimaryExpr()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.isTokenType(lexer.Dot, lexer.OpenBracket) {
 		operator := p.eat()
@@ -286,63 +1033,144 @@ func (p *Parser) parseMemberExpr() Expr {
 		var computed bool
 		if operator.TokenType == lexer.Dot {
 			computed = false
-			property = p.parsePrimaryExpr()
+			property, err = p.parsePrimaryExpr()
+			if err != nil {
+				return nil, err
+			}
 			if _, ok := property.(Identifier); !ok {
-				fmt.Println("Cannot use dot operator without right hand side being an identifier")
+				return nil, newSyntaxError(property.getSpan(), "Cannot use dot operator without right hand side being an identifier")
 			}
 		} else {
 			computed = true
-			property = p.parseExpr()
-			p.expect(lexer.CloseBracket)
+			property, err = p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(lexer.CloseBracket); err != nil {
+				return nil, err
+			}
 		}
-		object = MemberExpr{object, property, computed}
+		object = MemberExpr{Node{p.spanFrom(object.getSpan())}, object, property, computed}
 	}
-	return object
+	return object, nil
 }
-func (p *Parser) parsePrimaryExpr() Expr {
+func (p *Parser) parsePrimaryExpr() (Expr, error) {
 	switch p.at().TokenType {
 	case lexer.Identifier:
-		return Identifier{symbol: p.eat().Value}
+		token := p.eat()
+		return Identifier{Node: Node{token.Span}, symbol: token.Value}, nil
 	case lexer.Number:
-		value, err := strconv.ParseInt(p.at().Value, 10, 64)
+		token := p.eat()
+		if strings.ContainsAny(token.Value, ".eE") {
+			value, err := strconv.ParseFloat(token.Value, 64)
+			if err != nil {
+				return nil, newSyntaxError(token.Span, "Error while parsing number literal: '%v'", token.Value)
+			}
+			return NumericLiteral{Node: Node{token.Span}, floatValue: value, isFloat: true}, nil
+		}
+		value, err := strconv.ParseInt(token.Value, 10, 64)
 		if err != nil {
-			fmt.Printf("Error while parsing number literal: '%v' \n", p.eat().Value)
-			os.Exit(1)
+			return nil, newSyntaxError(token.Span, "Error while parsing number literal: '%v'", token.Value)
 		}
-		p.eat()
-		return NumericLiteral{value}
+		return NumericLiteral{Node: Node{token.Span}, value: value}, nil
 	case lexer.String:
-		return StringLiteral{value: p.eat().Value}
+		token := p.eat()
+		return StringLiteral{Node: Node{token.Span}, value: token.Value}, nil
+	case lexer.Template:
+		return p.parseTemplateLiteral(p.eat())
+	case lexer.Fn:
+		return p.parseFunctionExpr()
 	case lexer.OpenParen:
 		p.eat()
-		value := p.parseExpr()
-		if p.eat().TokenType != lexer.CloseParen {
-			fmt.Printf("Parser Error:\n - Expecting: CloseParen\n")
-			os.Exit(1)
-
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
-		return value
+		if _, err := p.expect(lexer.CloseParen); err != nil {
+			return nil, err
+		}
+		return value, nil
 	case lexer.OpenBracket:
-		p.eat()
-		elements := p.parseArgsList()
-		p.expect(lexer.CloseBracket)
-		return ArrayLiteral{elements}
+		openBracket := p.eat()
+		elements := make([]Expr, 0)
+		if !p.isTokenType(lexer.CloseBracket) {
+			var err error
+			if elements, err = p.parseArgsList(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.expect(lexer.CloseBracket); err != nil {
+			return nil, err
+		}
+		return ArrayLiteral{Node{p.spanFrom(openBracket.Span)}, elements}, nil
 	default:
 		token := p.eat()
-		fmt.Printf("Unexpected token found during parsing: '%v' Line:%v\n", token.Value, token.Line)
-		os.Exit(1)
-		panic("Unreachable code")
+		return nil, newSyntaxError(token.Span, "Unexpected token found during parsing: '%v'", token.Value)
 	}
 }
 
-func produceAst(sourceCode string) Program {
-	tokens := lexer.Tokenize(sourceCode)
+// parseTemplateLiteral parses each embedded expression of a template string
+// with its own parser.
+func (p *Parser) parseTemplateLiteral(token lexer.Token) (Expr, error) {
+	parts, err := lexer.SplitTemplate(token)
+	if err != nil {
+		return nil, fromLexerError(err)
+	}
+
+	template := TemplateLiteral{Node: Node{token.Span}, parts: make([]Expr, 0, len(parts))}
+	for _, part := range parts {
+		if !part.IsExpr {
+			template.parts = append(template.parts, StringLiteral{Node: Node{part.Span}, value: part.Value})
+			continue
+		}
+
+		tokens, err := lexer.TokenizeAt(part.Value, part.Span.Start)
+		if err != nil {
+			return nil, fromLexerError(err)
+		}
+		if tokens[0].TokenType == lexer.EOF {
+			return nil, newSyntaxError(part.Span, "Empty expression in template string")
+		}
+
+		parser := Parser{tokens: tokens}
+		expr, err := parser.parseExpr()
+		// Blocks inside the expression, such as function bodies, recover
+		// from their errors, so those have to be carried over as well.
+		p.errors = append(p.errors, parser.errors...)
+		if err != nil {
+			return nil, err
+		}
+		if !parser.isTokenType(lexer.EOF) {
+			return nil, newSyntaxError(parser.at().Span, "Unexpected token in template expression: '%v'", parser.at().Value)
+		}
+		template.parts = append(template.parts, expr)
+	}
+
+	return template, nil
+}
+
+func produceAst(sourceCode string) (Program, error) {
+	return produceAstAt(sourceCode, lexer.Position{Line: 1, Column: 1})
+}
+
+// produceAstAt parses source that starts at the given position of a longer
+// text, such as one input of a REPL session.
+func produceAstAt(sourceCode string, start lexer.Position) (Program, error) {
+	tokens, err := lexer.TokenizeAt(sourceCode, start)
+	if err != nil {
+		return Program{}, fromLexerError(err)
+	}
 
 	parser := Parser{tokens: tokens, currentTokenIndex: 0}
-	program := Program{body: make([]Stmt, 0)}
+	program := Program{Node: Node{joinSpans(tokens[0].Span, tokens[len(tokens)-1].Span)}, body: make([]Stmt, 0)}
 	for parser.at().TokenType != lexer.EOF {
-		program.body = append(program.body, parser.parseStmt())
+		if stmt, ok := parser.parseStmtRecovering(); ok {
+			program.body = append(program.body, stmt)
+		}
 	}
 
-	return program
+	if len(parser.errors) > 0 {
+		return program, parser.errors
+	}
+	return program, nil
 }
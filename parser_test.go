@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOperatorStrings(t *testing.T) {
+	expectValue(t, `"-"`, `"-"`)
+	expectValue(t, `let plus = "+"; [plus, "*", "/", "%"]`, `["+", "*", "/", "%"]`)
+	expectValue(t, `1 - 2 * -3`, "7")
+}
+
+func TestMatchArmValues(t *testing.T) {
+	expectValue(t, `let r = null; match (true) { true => r = "yes", false => r = "no" }
+		r`, `"yes"`)
+	expectValue(t, `const LIMIT = 3; let r = null; match (3) { LIMIT => r = "at limit" else => r = "other" }
+		r`, `"at limit"`)
+
+	apply := `
+		fn apply(op) {
+			let r = null;
+			match (op) {
+				"*" => r = "mul"
+				"-" => r = "sub"
+				"+" => r = "add", "/" => r = "div"
+			}
+			r
+		}
+		[apply("*"), apply("-"), apply("+"), apply("/")]`
+	expectValue(t, apply, `["mul", "sub", "add", "div"]`)
+}
+
+func TestTemplateBlockErrors(t *testing.T) {
+	source := "println(`${(() => { let = 5; return 1; })()}`);"
+	expectError(t, source, SyntaxError)
+
+	var stderr bytes.Buffer
+	if code := runCli([]string{"-e", source}, strings.NewReader(""), &stderr); code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+}
+
+func TestRecoveryStartsAtMismatchedToken(t *testing.T) {
+	tests := []struct {
+		source string
+		errors int
+	}{
+		{"fn f( { }\nlet c = ;", 2},
+		{"if (x { println(1) } let y = ;", 2},
+		{"let x = { a: , b: 2 };", 1},
+		{"fn g() { let = 1; }\nlet z = ;", 2},
+	}
+
+	for _, test := range tests {
+		_, err := produceAst(test.source)
+		list, ok := err.(ErrorList)
+		if !ok {
+			t.Errorf("%q: expected syntax errors, got %v", test.source, err)
+			continue
+		}
+		if len(list) != test.errors {
+			t.Errorf("%q: got %d errors, want %d: %v", test.source, len(list), test.errors, list)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+type Repl struct {
+	env     Env
+	history []string
+	in      *bufio.Scanner
+	out     io.Writer
+	// errOut receives the diagnostics of inputs that failed.
+	errOut io.Writer
+	// session holds every input so far, one after another, so diagnostics
+	// can show code declared by earlier inputs.
+	session string
+	// next is where the next input starts in session.
+	next lexer.Position
+}
+
+func newRepl(in io.Reader, out, errOut io.Writer, options Options) Repl {
+	return Repl{
+		env:    createGlobalEnv(options),
+		in:     bufio.NewScanner(in),
+		out:    out,
+		errOut: errOut,
+		next:   lexer.Position{Line: 1, Column: 1},
+	}
+}
+
+func (r *Repl) run() int {
+	fmt.Fprintln(r.out, "Type :help for a list of commands.")
+
+	for {
+		input, ok := r.readInput()
+		if !ok {
+			fmt.Fprintln(r.out)
+			return exitSuccess
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		switch strings.TrimSpace(input) {
+		case ":quit", ":exit":
+			return exitSuccess
+		case ":help":
+			fmt.Fprintln(r.out, ":history  list the inputs entered in this session")
+			fmt.Fprintln(r.out, ":quit     leave the REPL")
+			continue
+		case ":history":
+			for i, entry := range r.history {
+				fmt.Fprintf(r.out, "%4d  %s\n", i+1, entry)
+			}
+			continue
+		}
+
+		r.history = append(r.history, input)
+		result, err := r.eval(input)
+		if err != nil {
+			fmt.Fprintln(r.errOut, formatDiagnostic(err, "<repl>", r.session))
+			continue
+		}
+		fmt.Fprintln(r.out, result)
+	}
+}
+
+// readInput keeps reading continuation lines while the input has unclosed
+// parens, braces, brackets or backtick strings.
+func (r *Repl) readInput() (string, bool) {
+	fmt.Fprint(r.out, prompt)
+	if !r.in.Scan() {
+		return "", false
+	}
+	input := r.in.Text()
+
+	for openDelimiters(input) > 0 {
+		fmt.Fprint(r.out, continuationPrompt)
+		if !r.in.Scan() {
+			break
+		}
+		input += "\n" + r.in.Text()
+	}
+
+	return input, true
+}
+
+func (r *Repl) eval(input string) (RuntimeVal, error) {
+	start := r.next
+	r.session += input + "\n"
+	r.next = lexer.Position{Line: start.Line + uint64(strings.Count(input, "\n")) + 1, Column: 1, Offset: len(r.session)}
+
+	program, err := produceAstAt(input, start)
+	if err != nil {
+		return nil, err
+	}
+	return program.evaluate(&r.env)
+}
+
+func openDelimiters(input string) int {
+	tokens, err := lexer.Tokenize(input)
+	if err != nil {
+		// A backtick string left open continues on the next line. Other input
+		// the lexer rejects is complete, and evaluating it reports the error.
+		if lexErr, ok := err.(*lexer.Error); ok && lexErr.Incomplete {
+			return 1
+		}
+		return 0
+	}
+
+	depth := 0
+	for _, token := range tokens {
+		switch token.TokenType {
+		case lexer.OpenParen, lexer.OpenBrace, lexer.OpenBracket:
+			depth++
+		case lexer.CloseParen, lexer.CloseBrace, lexer.CloseBracket:
+			depth--
+		}
+	}
+	return depth
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
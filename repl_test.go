@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var colorCodes = regexp.MustCompile("\033\\[[0-9]+m")
+
+// runRepl feeds input to a REPL session and returns its error output
+// without colors.
+func runRepl(input string) string {
+	var out, errOut bytes.Buffer
+	repl := newRepl(strings.NewReader(input), &out, &errOut, Options{maxCallDepth: defaultMaxCallDepth})
+	repl.run()
+	return colorCodes.ReplaceAllString(errOut.String(), "")
+}
+
+func TestReplDiagnosticsShowEarlierInputs(t *testing.T) {
+	got := runRepl("fn f(a) {\n  a + missing\n}\nf()\nf(1)\n")
+
+	for _, want := range []string{
+		"--> <repl>:4:1\n  |\n4 | f()",
+		"note: 'f' is declared here\n  --> <repl>:1:1\n  |\n1 | fn f(a) {",
+		"--> <repl>:2:7\n  |\n2 |   a + missing",
+		"at f (<repl>:5:1)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
-	"main/colors"
+	"github.com/IgorM867/interpreter-in-go/colors"
+	"github.com/IgorM867/interpreter-in-go/lexer"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type RuntimeVal interface {
@@ -12,6 +19,10 @@ type RuntimeVal interface {
 type NullVal struct{}
 type NumberVal struct {
 	value int64
+	// floatValue holds the number when isFloat is set. Integers stay in value
+	// so they keep full int64 precision.
+	floatValue float64
+	isFloat    bool
 }
 type StringVaL struct {
 	value string
@@ -22,45 +33,126 @@ type BooleanVal struct {
 type Object struct {
 	properties map[string]RuntimeVal
 }
-type FunctionCall func(args []RuntimeVal, env *Env) RuntimeVal
+type FunctionCall func(args []RuntimeVal, env *Env) (RuntimeVal, error)
 type NativeFn struct {
 	call FunctionCall
 }
 type Function struct {
 	name           string
-	parameters     []string
+	parameters     []Parameter
 	declarationEnv *Env
 	body           []Stmt
+	// id tells functions apart for `==`, even when they share a body and scope.
+	id uint64
+	// declaredAt is the span of the function's declaration or expression.
+	declaredAt lexer.Span
+	// arrow functions have no `this` of their own and see the one of the scope
+	// they were created in.
+	arrow bool
 }
+
+var functionCount uint64
+
+func newFunction(name string, parameters []Parameter, declarationEnv *Env, body []Stmt, declaredAt lexer.Span) Function {
+	functionCount++
+	return Function{name: name, parameters: parameters, declarationEnv: declarationEnv, body: body, id: functionCount, declaredAt: declaredAt}
+}
+
 type Array struct {
 	elements []RuntimeVal
 }
 
-func (lhs NumberVal) binaryOperation(operator string, rhs NumberVal) NumberVal {
+// ErrorVal is the value of errors created with Error() and of errors raised by
+// the interpreter once a catch clause receives them.
+type ErrorVal struct {
+	kind    ErrorKind
+	message string
+	span    lexer.Span
+	// stack is the call stack where the error was raised, nil when unknown.
+	stack []Frame
+}
+
+func newFloat(value float64) NumberVal {
+	return NumberVal{floatValue: value, isFloat: true}
+}
+func (num NumberVal) float() float64 {
+	if num.isFloat {
+		return num.floatValue
+	}
+	return float64(num.value)
+}
+
+// binaryOperation works on integers while both sides are integers and
+// promotes to float as soon as one of them is a float. Division of integers
+// that does not divide evenly yields a float.
+func (lhs NumberVal) binaryOperation(operator string, rhs NumberVal) (NumberVal, error) {
+	if (operator == "/" || operator == "%") && rhs.float() == 0 {
+		return NumberVal{}, newRangeError(lexer.Span{}, "Cannot divide by 0")
+	}
+	if lhs.isFloat || rhs.isFloat || operator == "/" && lhs.value%rhs.value != 0 {
+		return lhs.floatOperation(operator, rhs)
+	}
+
 	switch operator {
 	case "+":
-		return NumberVal{value: lhs.value + rhs.value}
+		return NumberVal{value: lhs.value + rhs.value}, nil
 	case "-":
-		return NumberVal{value: lhs.value - rhs.value}
+		return NumberVal{value: lhs.value - rhs.value}, nil
 	case "*":
-		return NumberVal{value: lhs.value * rhs.value}
+		return NumberVal{value: lhs.value * rhs.value}, nil
 	case "/":
-		if rhs.value == 0 {
-			panic("Cannod divide by 0!")
-		}
-		return NumberVal{value: lhs.value / rhs.value}
+		return NumberVal{value: lhs.value / rhs.value}, nil
+	case "%":
+		return NumberVal{value: lhs.value % rhs.value}, nil
+	default:
+		return NumberVal{}, newTypeError(lexer.Span{}, "invalid operator: %s", operator)
+	}
+}
+func (lhs NumberVal) floatOperation(operator string, rhs NumberVal) (NumberVal, error) {
+	switch operator {
+	case "+":
+		return newFloat(lhs.float() + rhs.float()), nil
+	case "-":
+		return newFloat(lhs.float() - rhs.float()), nil
+	case "*":
+		return newFloat(lhs.float() * rhs.float()), nil
+	case "/":
+		return newFloat(lhs.float() / rhs.float()), nil
 	case "%":
-		return NumberVal{value: lhs.value % rhs.value}
+		return newFloat(math.Mod(lhs.float(), rhs.float())), nil
 	default:
-		panic(fmt.Sprintf("invalid operator: %s\n", operator))
+		return NumberVal{}, newTypeError(lexer.Span{}, "invalid operator: %s", operator)
+	}
+}
+func (lhs NumberVal) compare(operator string, rhs NumberVal) bool {
+	if lhs.isFloat || rhs.isFloat {
+		return compareOrdered(operator, lhs.float(), rhs.float())
+	}
+	return compareOrdered(operator, lhs.value, rhs.value)
+}
+func compareOrdered[T cmp.Ordered](operator string, lhs, rhs T) bool {
+	switch operator {
+	case "==":
+		return lhs == rhs
+	case "!=":
+		return lhs != rhs
+	case "<":
+		return lhs < rhs
+	case ">":
+		return lhs > rhs
+	case "<=":
+		return lhs <= rhs
+	case ">=":
+		return lhs >= rhs
 	}
+	return false
 }
-func (lhs StringVaL) binaryOperation(operator string, rhs StringVaL) StringVaL {
+func (lhs StringVaL) binaryOperation(operator string, rhs StringVaL) (StringVaL, error) {
 	switch operator {
 	case "+":
-		return StringVaL{value: lhs.value + rhs.value}
+		return StringVaL{value: lhs.value + rhs.value}, nil
 	default:
-		panic(fmt.Sprintf("invalid string operatorion: %s\n", operator))
+		return StringVaL{}, newTypeError(lexer.Span{}, "invalid string operation: %s", operator)
 	}
 }
 func (NullVal) getType() string {
@@ -87,8 +179,22 @@ func (Function) getType() string {
 func (Array) getType() string {
 	return "Array"
 }
+func (ErrorVal) getType() string {
+	return "Error"
+}
+func (num NumberVal) format() string {
+	if !num.isFloat {
+		return strconv.FormatInt(num.value, 10)
+	}
+
+	abs := math.Abs(num.floatValue)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(num.floatValue, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(num.floatValue, 'f', -1, 64)
+}
 func (num NumberVal) String() string {
-	return colors.GreenString(fmt.Sprintf("%d", num.value))
+	return colors.GreenString(num.format())
 }
 func (str StringVaL) String() string {
 	return colors.YellowString(fmt.Sprintf(`"%s"`, str.value))
@@ -100,19 +206,7 @@ func (boolean BooleanVal) String() string {
 	return colors.MagentaString(fmt.Sprintf("%v", boolean.value))
 }
 func (obj Object) String() string {
-	str := "{"
-	count := len(obj.properties)
-
-	for key, value := range obj.properties {
-		count--
-		str += fmt.Sprintf(" %v: %v", key, value)
-		if count > 0 {
-			str += ","
-		}
-	}
-
-	str += " }"
-	return str
+	return coloredText(obj, visiting{})
 }
 func (NativeFn) String() string {
 	return "[Function]"
@@ -121,9 +215,243 @@ func (Function) String() string {
 	return "[Function]"
 }
 func (array Array) String() string {
-	return fmt.Sprintf("%v", array.elements)
+	return coloredText(array, visiting{})
+}
+func (e ErrorVal) String() string {
+	return colors.RedString(toText(e))
+}
+
+// properties are the fields scripts can read from an error: kind, message,
+// line and column, which are null when the position is unknown, and stack,
+// the calls that led to the error as "name (line:column)" strings.
+func (e ErrorVal) properties() map[string]RuntimeVal {
+	stack := make([]RuntimeVal, len(e.stack))
+	for i, frame := range e.stack {
+		stack[i] = StringVaL{value: frame.String()}
+	}
+	properties := map[string]RuntimeVal{
+		"kind":    StringVaL{value: e.kind.String()},
+		"message": StringVaL{value: e.message},
+		"line":    NullVal{},
+		"column":  NullVal{},
+		"stack":   Array{stack},
+	}
+	if !e.span.IsZero() {
+		properties["line"] = NumberVal{value: int64(e.span.Start.Line)}
+		properties["column"] = NumberVal{value: int64(e.span.Start.Column)}
+	}
+	return properties
+}
+
+func (obj Object) keys() []string {
+	keys := make([]string, 0, len(obj.properties))
+	for key := range obj.properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func compareTypes(val1, val2 RuntimeVal) bool {
 	return fmt.Sprintf("%T", val1) == fmt.Sprintf("%T", val2)
 }
+
+// visiting holds the arrays and objects that are being printed, so a value
+// that contains itself prints as [Circular] instead of recursing forever.
+type visiting map[uintptr]bool
+
+// enter marks an array or object as being printed. It reports false when
+// the value is already being printed further out, i.e. it contains itself.
+func (v visiting) enter(val RuntimeVal) bool {
+	id := identity(val)
+	if v[id] {
+		return false
+	}
+	v[id] = true
+	return true
+}
+
+func (v visiting) leave(val RuntimeVal) {
+	delete(v, identity(val))
+}
+
+// identity tells arrays and objects apart by their shared storage.
+func identity(val RuntimeVal) uintptr {
+	switch val := val.(type) {
+	case Array:
+		return reflect.ValueOf(val.elements).Pointer()
+	case Object:
+		return reflect.ValueOf(val.properties).Pointer()
+	default:
+		return 0
+	}
+}
+
+// coloredText renders a value for String(), with arrays and objects walked
+// through visiting.
+func coloredText(val RuntimeVal, seen visiting) string {
+	switch val := val.(type) {
+	case Array:
+		if !seen.enter(val) {
+			return "[Circular]"
+		}
+		defer seen.leave(val)
+		elements := make([]string, len(val.elements))
+		for i, elem := range val.elements {
+			elements[i] = coloredText(elem, seen)
+		}
+		return "[" + strings.Join(elements, " ") + "]"
+	case Object:
+		if !seen.enter(val) {
+			return "[Circular]"
+		}
+		defer seen.leave(val)
+		properties := make([]string, 0, len(val.properties))
+		for _, key := range val.keys() {
+			properties = append(properties, fmt.Sprintf(" %v: %v", key, coloredText(val.properties[key], seen)))
+		}
+		return "{" + strings.Join(properties, ",") + " }"
+	default:
+		return val.String()
+	}
+}
+
+// toText converts a value to the plain text used when it is embedded in a
+// string. Unlike String() it has no colors and strings are not quoted.
+func toText(val RuntimeVal) string {
+	return plainText(val, false, visiting{})
+}
+
+// quotedText is toText for values nested in arrays and objects, where strings keep their quotes.
+func quotedText(val RuntimeVal) string {
+	return plainText(val, true, visiting{})
+}
+
+func plainText(val RuntimeVal, quoted bool, seen visiting) string {
+	switch val := val.(type) {
+	case StringVaL:
+		if quoted {
+			return strconv.Quote(val.value)
+		}
+		return val.value
+	case NumberVal:
+		return val.format()
+	case BooleanVal:
+		return strconv.FormatBool(val.value)
+	case NullVal:
+		return "null"
+	case ErrorVal:
+		return fmt.Sprintf("%v: %s", val.kind, val.message)
+	case Array:
+		if !seen.enter(val) {
+			return "[Circular]"
+		}
+		defer seen.leave(val)
+		elements := make([]string, len(val.elements))
+		for i, elem := range val.elements {
+			elements[i] = plainText(elem, true, seen)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case Object:
+		if !seen.enter(val) {
+			return "[Circular]"
+		}
+		defer seen.leave(val)
+		keys := val.keys()
+		properties := make([]string, len(keys))
+		for i, key := range keys {
+			properties[i] = fmt.Sprintf("%s: %s", key, plainText(val.properties[key], true, seen))
+		}
+		if len(properties) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(properties, ", ") + " }"
+	default:
+		return "[Function]"
+	}
+}
+
+func isTruthy(val RuntimeVal) bool {
+	switch val := val.(type) {
+	case NullVal:
+		return false
+	case BooleanVal:
+		return val.value
+	case NumberVal:
+		return val.float() != 0
+	case StringVaL:
+		return val.value != ""
+	case Array:
+		return len(val.elements) > 0
+	default:
+		return true
+	}
+}
+
+// valuesEqual compares values structurally: arrays and objects are equal when
+// all their elements are, functions only when they are the same function.
+// Values of different types are never equal.
+func valuesEqual(lhs, rhs RuntimeVal) bool {
+	return deepEqual(lhs, rhs, make(map[[2]uintptr]bool))
+}
+
+// deepEqual keeps the pairs of arrays and objects it is already comparing in
+// seen, so values that contain themselves do not recurse forever.
+func deepEqual(lhs, rhs RuntimeVal, seen map[[2]uintptr]bool) bool {
+	if !compareTypes(lhs, rhs) {
+		return false
+	}
+
+	switch lhs := lhs.(type) {
+	case NullVal:
+		return true
+	case NumberVal:
+		return lhs.compare("==", rhs.(NumberVal))
+	case StringVaL:
+		return lhs.value == rhs.(StringVaL).value
+	case BooleanVal:
+		return lhs.value == rhs.(BooleanVal).value
+	case Function:
+		return lhs.id == rhs.(Function).id
+	case ErrorVal:
+		rhs := rhs.(ErrorVal)
+		return lhs.kind == rhs.kind && lhs.message == rhs.message && lhs.span == rhs.span
+	case NativeFn:
+		return reflect.ValueOf(lhs.call).Pointer() == reflect.ValueOf(rhs.(NativeFn).call).Pointer()
+	case Array:
+		rhs := rhs.(Array)
+		if len(lhs.elements) != len(rhs.elements) {
+			return false
+		}
+		pair := [2]uintptr{reflect.ValueOf(lhs.elements).Pointer(), reflect.ValueOf(rhs.elements).Pointer()}
+		if pair[0] == pair[1] || seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for i := range lhs.elements {
+			if !deepEqual(lhs.elements[i], rhs.elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case Object:
+		rhs := rhs.(Object)
+		if len(lhs.properties) != len(rhs.properties) {
+			return false
+		}
+		pair := [2]uintptr{reflect.ValueOf(lhs.properties).Pointer(), reflect.ValueOf(rhs.properties).Pointer()}
+		if pair[0] == pair[1] || seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for key, value := range lhs.properties {
+			other, ok := rhs.properties[key]
+			if !ok || !deepEqual(value, other, seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
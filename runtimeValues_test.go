@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCyclicValuesPrint(t *testing.T) {
+	expectValue(t, "let o = {}; o.self = o; o", "{ self: [Circular] }")
+	expectValue(t, "let o = {}; o.self = o; `${o}`", `"{ self: [Circular] }"`)
+	expectValue(t, "let a = [1]; a[0] = a; a", "[[Circular]]")
+
+	val, err := evalSource("let o = { a: [1] }; o.a[0] = o; o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := val.String(); !strings.Contains(got, "[Circular]") {
+		t.Errorf("got %s, want [Circular] in it", got)
+	}
+}
+
+func TestSharedValuesPrintInFull(t *testing.T) {
+	expectValue(t, "let s = [1]; [s, s]", "[[1], [1]]")
+}